@@ -0,0 +1,39 @@
+package ecur
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// The address cache is a JSON object mapping ECU IDs to their last known address
+
+func loadCachedAddress(path, ecuID string) (string, bool) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	var addresses map[string]string
+	if err := json.Unmarshal(body, &addresses); err != nil {
+		return "", false
+	}
+	addr, ok := addresses[ecuID]
+	return addr, ok && addr != ""
+}
+
+func saveCachedAddress(path, ecuID, address string) error {
+	addresses := map[string]string{}
+	if body, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(body, &addresses)
+	}
+	addresses[ecuID] = address
+
+	body, err := json.MarshalIndent(addresses, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, body, 0o644)
+}
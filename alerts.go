@@ -0,0 +1,261 @@
+package ecur
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Metrics that can be used in alert rules
+const (
+	MetricECUPower     = "ecu_power"     // W, per ECU
+	MetricTemperature  = "temperature"   // Celsius, per inverter
+	MetricFrequency    = "frequency"     // Hz, per inverter
+	MetricVoltage      = "voltage"       // V, per inverter
+	MetricSignal       = "signal"        // %, per inverter
+	MetricChannelPower = "channel_power" // W, per channel
+	MetricChannelRatio = "channel_ratio" // channel power / average of sibling channels
+)
+
+type AlertState string
+
+const (
+	AlertPending  AlertState = "pending"
+	AlertFiring   AlertState = "firing"
+	AlertResolved AlertState = "resolved"
+)
+
+// AlertRule describes a condition on a single metric. The condition is true
+// when the value is above Above or below Below (either may be omitted, set
+// both for a range). The rule fires once the condition has held for For
+type AlertRule struct {
+	Name   string        `yaml:"name"`
+	Metric string        `yaml:"metric"`
+	Above  *float64      `yaml:"above"`
+	Below  *float64      `yaml:"below"`
+	For    time.Duration `yaml:"for"`
+}
+
+// Alert is the state of a rule for a single subject (ECU, inverter or channel)
+type Alert struct {
+	Rule       string
+	State      AlertState
+	EcuID      string
+	InverterID string `json:",omitempty"`
+	Channel    string `json:",omitempty"`
+	Value      float64
+	Since      time.Time // first time the condition was true
+	Time       time.Time // time of the last state change
+}
+
+func (a Alert) String() string {
+	subject := a.EcuID
+	if a.InverterID != "" {
+		subject += "/" + a.InverterID
+	}
+	if a.Channel != "" {
+		subject += "/" + a.Channel
+	}
+	return fmt.Sprintf("%s [%s] %s on %s (value %.2f, since %s)", a.Time.Format("2006-01-02 15:04:05"), a.State, a.Rule, subject, a.Value, a.Since.Format("15:04:05"))
+}
+
+// LoadAlertRules reads alert rules from a YAML file with a top level 'rules' list
+func LoadAlertRules(path string) ([]AlertRule, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read alert rules: %w", err)
+	}
+	var file struct {
+		Rules []AlertRule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(body, &file); err != nil {
+		return nil, fmt.Errorf("could not parse alert rules: %w", err)
+	}
+	return file.Rules, nil
+}
+
+// Validate returns an error if the rule can never be evaluated
+func (r AlertRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule without name: %w", ErrInvalidRule)
+	}
+	switch r.Metric {
+	case MetricECUPower, MetricTemperature, MetricFrequency, MetricVoltage,
+		MetricSignal, MetricChannelPower, MetricChannelRatio:
+	default:
+		return fmt.Errorf("rule %q has unknown metric %q: %w", r.Name, r.Metric, ErrInvalidRule)
+	}
+	if r.Above == nil && r.Below == nil {
+		return fmt.Errorf("rule %q needs a threshold (above and/or below): %w", r.Name, ErrInvalidRule)
+	}
+	return nil
+}
+
+// ValidateAlertRules validates every rule, and returns an error if rules
+// share a name: alerts are tracked by rule name
+func ValidateAlertRules(rules []AlertRule) error {
+	names := map[string]bool{}
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		if names[r.Name] {
+			return fmt.Errorf("rule %q is defined more than once: %w", r.Name, ErrInvalidRule)
+		}
+		names[r.Name] = true
+	}
+	return nil
+}
+
+func (r AlertRule) matches(value float64) bool {
+	return (r.Above != nil && value > *r.Above) || (r.Below != nil && value < *r.Below)
+}
+
+// AlertEngine evaluates alert rules against snapshots. It keeps track of the
+// state per rule and subject so that every problem is reported only once
+type AlertEngine struct {
+	rules  []AlertRule
+	active map[string]*Alert
+}
+
+func NewAlertEngine(rules []AlertRule) (*AlertEngine, error) {
+	if err := ValidateAlertRules(rules); err != nil {
+		return nil, err
+	}
+	return &AlertEngine{
+		rules:  rules,
+		active: map[string]*Alert{},
+	}, nil
+}
+
+// Evaluate applies all rules to the snapshot and returns the alerts that
+// started firing or were resolved. Pending alerts are tracked, but not
+// returned. Alerts of subjects without a value in the snapshot, such as
+// offline inverters, keep their state
+func (e *AlertEngine) Evaluate(s Snapshot) []Alert {
+	var notify []Alert
+	seen := map[string]bool{}
+	sampled := map[string]bool{}
+
+	for _, rule := range e.rules {
+		for _, sample := range metricSamples(s, rule.Metric) {
+			key := rule.Name + "|" + sample.inverterID + "|" + sample.channel
+			sampled[key] = true
+			if !rule.matches(sample.value) {
+				continue
+			}
+			seen[key] = true
+
+			alert, ok := e.active[key]
+			if !ok {
+				alert = &Alert{
+					Rule:       rule.Name,
+					State:      AlertPending,
+					EcuID:      s.ECUInfo.EcuID,
+					InverterID: sample.inverterID,
+					Channel:    sample.channel,
+					Since:      s.CollectedAt,
+					Time:       s.CollectedAt,
+				}
+				e.active[key] = alert
+			}
+			alert.Value = sample.value
+
+			if alert.State == AlertPending && s.CollectedAt.Sub(alert.Since) >= rule.For {
+				alert.State = AlertFiring
+				alert.Time = s.CollectedAt
+				notify = append(notify, *alert)
+			}
+		}
+	}
+
+	// Conditions that no longer hold resolve firing alerts and reset pending ones
+	for key, alert := range e.active {
+		if seen[key] || !sampled[key] {
+			continue
+		}
+		if alert.State == AlertFiring {
+			alert.State = AlertResolved
+			alert.Time = s.CollectedAt
+			notify = append(notify, *alert)
+		}
+		delete(e.active, key)
+	}
+
+	sortAlerts(notify)
+	return notify
+}
+
+// Active returns all pending and firing alerts
+func (e *AlertEngine) Active() []Alert {
+	var res []Alert
+	for _, a := range e.active {
+		res = append(res, *a)
+	}
+	sortAlerts(res)
+	return res
+}
+
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := alerts[i], alerts[j]
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		if a.InverterID != b.InverterID {
+			return a.InverterID < b.InverterID
+		}
+		return a.Channel < b.Channel
+	})
+}
+
+type metricSample struct {
+	inverterID string
+	channel    string
+	value      float64
+}
+
+// metricSamples extracts all values of a metric from the snapshot. Offline
+// inverters do not report meaningful values and are skipped
+func metricSamples(s Snapshot, metric string) []metricSample {
+	if metric == MetricECUPower {
+		return []metricSample{{value: float64(s.ECUInfo.LastPower)}}
+	}
+
+	var res []metricSample
+	for _, inv := range s.ArrayInfo.Inverters {
+		if !inv.Online {
+			continue
+		}
+		switch metric {
+		case MetricTemperature:
+			res = append(res, metricSample{inverterID: inv.ID, value: float64(inv.Temperature)})
+		case MetricFrequency:
+			res = append(res, metricSample{inverterID: inv.ID, value: inv.Frequency})
+		case MetricVoltage:
+			res = append(res, metricSample{inverterID: inv.ID, value: float64(inv.VoltageA)})
+		case MetricSignal:
+			if signal, ok := s.Signal(inv.ID); ok {
+				res = append(res, metricSample{inverterID: inv.ID, value: SignalPercent(signal)})
+			}
+		case MetricChannelPower:
+			for _, ch := range inv.Channels() {
+				res = append(res, metricSample{inverterID: inv.ID, channel: ch.Name, value: float64(ch.Power)})
+			}
+		case MetricChannelRatio:
+			channels := inv.Channels()
+			total := inv.TotalPower()
+			for _, ch := range channels {
+				siblings := float64(total-ch.Power) / float64(len(channels)-1)
+				if siblings <= 0 {
+					continue
+				}
+				res = append(res, metricSample{inverterID: inv.ID, channel: ch.Name, value: float64(ch.Power) / siblings})
+			}
+		}
+	}
+	return res
+}
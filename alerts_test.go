@@ -0,0 +1,130 @@
+package ecur
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAlertRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	err := os.WriteFile(path, []byte(`
+rules:
+  - name: hot inverter
+    metric: temperature
+    above: 75
+    for: 10m
+  - name: grid frequency
+    metric: frequency
+    below: 49.8
+    above: 50.2
+`), 0o644)
+	require.NoError(t, err)
+
+	rules, err := LoadAlertRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	require.Equal(t, 10*time.Minute, rules[0].For)
+	require.Equal(t, 75.0, *rules[0].Above)
+	require.Nil(t, rules[0].Below)
+	require.Equal(t, 49.8, *rules[1].Below)
+
+	_, err = NewAlertEngine(rules)
+	require.NoError(t, err)
+}
+
+func TestAlertRuleValidation(t *testing.T) {
+	limit := 1.0
+	_, err := NewAlertEngine([]AlertRule{{Name: "x", Metric: "humidity", Above: &limit}})
+	require.ErrorIs(t, err, ErrInvalidRule)
+
+	_, err = NewAlertEngine([]AlertRule{{Name: "x", Metric: MetricTemperature}})
+	require.ErrorIs(t, err, ErrInvalidRule)
+
+	_, err = NewAlertEngine([]AlertRule{
+		{Name: "x", Metric: MetricTemperature, Above: &limit},
+		{Name: "x", Metric: MetricVoltage, Below: &limit},
+	})
+	require.ErrorIs(t, err, ErrInvalidRule)
+}
+
+func TestAlertEngineLifecycle(t *testing.T) {
+	limit := 75.0
+	engine, err := NewAlertEngine([]AlertRule{{Name: "hot", Metric: MetricTemperature, Above: &limit, For: 10 * time.Minute}})
+	require.NoError(t, err)
+
+	start := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	poll := func(minutes int, temperature int) []Alert {
+		s := testSnapshot(start.Add(time.Duration(minutes) * time.Minute))
+		s.ArrayInfo.Inverters[0].Temperature = temperature
+		return engine.Evaluate(s)
+	}
+
+	// Pending, not yet reported
+	require.Empty(t, poll(0, 80))
+	require.Equal(t, AlertPending, engine.Active()[0].State)
+	require.Empty(t, poll(5, 80))
+
+	// Fires once after 10 minutes
+	alerts := poll(10, 81)
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertFiring, alerts[0].State)
+	require.Equal(t, "801000030000", alerts[0].InverterID)
+	require.Equal(t, 81.0, alerts[0].Value)
+	require.Equal(t, start, alerts[0].Since)
+
+	// Deduplicated while still firing
+	require.Empty(t, poll(15, 82))
+
+	// Resolved once the condition clears
+	alerts = poll(20, 60)
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertResolved, alerts[0].State)
+	require.Empty(t, engine.Active())
+
+	// A short spike never fires
+	require.Empty(t, poll(25, 80))
+	require.Empty(t, poll(30, 60))
+	require.Empty(t, engine.Active())
+}
+
+func TestAlertEngineOfflineInverter(t *testing.T) {
+	limit := 75.0
+	engine, err := NewAlertEngine([]AlertRule{{Name: "hot", Metric: MetricTemperature, Above: &limit}})
+	require.NoError(t, err)
+
+	s := testSnapshot(time.Now())
+	s.ArrayInfo.Inverters[0].Temperature = 80
+	alerts := engine.Evaluate(s)
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertFiring, alerts[0].State)
+
+	// An offline inverter has no value, the alert keeps firing
+	s.ArrayInfo.Inverters[0].Online = false
+	require.Empty(t, engine.Evaluate(s))
+	require.Equal(t, AlertFiring, engine.Active()[0].State)
+
+	s.ArrayInfo.Inverters[0].Online = true
+	s.ArrayInfo.Inverters[0].Temperature = 60
+	alerts = engine.Evaluate(s)
+	require.Len(t, alerts, 1)
+	require.Equal(t, AlertResolved, alerts[0].State)
+}
+
+func TestAlertChannelRatio(t *testing.T) {
+	half := 0.5
+	engine, err := NewAlertEngine([]AlertRule{{Name: "weak panel", Metric: MetricChannelRatio, Below: &half}})
+	require.NoError(t, err)
+
+	s := testSnapshot(time.Now())
+	inv := &s.ArrayInfo.Inverters[0]
+	inv.PowerA, inv.PowerB, inv.PowerC, inv.PowerD = 200, 210, 190, 80
+
+	alerts := engine.Evaluate(s)
+	require.Len(t, alerts, 1)
+	require.Equal(t, "D", alerts[0].Channel)
+	require.InDelta(t, 0.4, alerts[0].Value, 0.001)
+}
@@ -0,0 +1,150 @@
+package ecur
+
+import (
+	"sort"
+)
+
+// PanelAnalysisOptions configures AnalyzePanels
+type PanelAnalysisOptions struct {
+	// MinPower skips samples where the average channel power of the array is
+	// below this value (in W). Dawn and dusk readings are too noisy to compare
+	MinPower float64
+	// Threshold is the ratio below which a sample counts as underperforming
+	Threshold float64
+	// Consistency is the fraction of samples that need to be below the
+	// threshold before a channel is flagged
+	Consistency float64
+}
+
+func DefaultPanelAnalysisOptions() PanelAnalysisOptions {
+	return PanelAnalysisOptions{
+		MinPower:    20,
+		Threshold:   0.8,
+		Consistency: 0.75,
+	}
+}
+
+// PanelReport describes the performance of a single channel relative to the
+// other channels on the same inverter and to all channels in the array
+type PanelReport struct {
+	InverterID      string
+	Channel         string
+	Samples         int
+	InverterRatio   float64 // average power relative to the other channels on the inverter
+	ArrayRatio      float64 // average power relative to the other channels in the array
+	BelowThreshold  float64 // fraction of samples with an inverter ratio below the threshold
+	Underperforming bool
+}
+
+type channelKey struct {
+	inverterID string
+	channel    string
+}
+
+// ratioSums accumulates ratios per hour of the day, so that every hour
+// carries the same weight regardless of the number of samples in it
+type ratioSums struct {
+	inverter map[int][]float64
+	array    map[int][]float64
+	below    int
+	samples  int
+}
+
+// AnalyzePanels compares every channel with its siblings over a series of
+// snapshots. Ratios are first averaged per hour of the day and then across
+// hours, which normalises for the time of day the samples were taken
+func AnalyzePanels(snapshots []Snapshot, opts PanelAnalysisOptions) []PanelReport {
+	sums := map[channelKey]*ratioSums{}
+
+	for _, s := range snapshots {
+		hour := s.ArrayInfo.Timestamp.Hour()
+
+		// Array totals over all online channels
+		arrayTotal, arrayChannels := 0, 0
+		for _, inv := range s.ArrayInfo.Inverters {
+			if !inv.Online {
+				continue
+			}
+			arrayTotal += inv.TotalPower()
+			arrayChannels += len(inv.Channels())
+		}
+		if arrayChannels < 2 || float64(arrayTotal)/float64(arrayChannels) < opts.MinPower {
+			continue
+		}
+
+		for _, inv := range s.ArrayInfo.Inverters {
+			if !inv.Online {
+				continue
+			}
+			channels := inv.Channels()
+			total := inv.TotalPower()
+			for _, ch := range channels {
+				siblings := float64(total-ch.Power) / float64(len(channels)-1)
+				others := float64(arrayTotal-ch.Power) / float64(arrayChannels-1)
+				if siblings <= 0 || others <= 0 {
+					continue
+				}
+
+				key := channelKey{inv.ID, ch.Name}
+				sum, ok := sums[key]
+				if !ok {
+					sum = &ratioSums{inverter: map[int][]float64{}, array: map[int][]float64{}}
+					sums[key] = sum
+				}
+				ratio := float64(ch.Power) / siblings
+				sum.inverter[hour] = append(sum.inverter[hour], ratio)
+				sum.array[hour] = append(sum.array[hour], float64(ch.Power)/others)
+				sum.samples++
+				if ratio < opts.Threshold {
+					sum.below++
+				}
+			}
+		}
+	}
+
+	var reports []PanelReport
+	for key, sum := range sums {
+		below := float64(sum.below) / float64(sum.samples)
+		inverterRatio := hourlyMean(sum.inverter)
+		reports = append(reports, PanelReport{
+			InverterID:      key.inverterID,
+			Channel:         key.channel,
+			Samples:         sum.samples,
+			InverterRatio:   inverterRatio,
+			ArrayRatio:      hourlyMean(sum.array),
+			BelowThreshold:  below,
+			Underperforming: below >= opts.Consistency && inverterRatio < opts.Threshold,
+		})
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].InverterID != reports[j].InverterID {
+			return reports[i].InverterID < reports[j].InverterID
+		}
+		return reports[i].Channel < reports[j].Channel
+	})
+	return reports
+}
+
+// hourlyMean averages the values per hour first and then across hours
+func hourlyMean(values map[int][]float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, v := range values {
+		total += mean(v)
+	}
+	return total / float64(len(values))
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
@@ -0,0 +1,50 @@
+package ecur
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// panelSnapshots returns a day of samples for two QS1 inverters where
+// channel D of the first inverter produces at the given fraction of the others
+func panelSnapshots(fraction float64) []Snapshot {
+	var snapshots []Snapshot
+	day := time.Date(2021, 6, 21, 0, 0, 0, 0, time.UTC)
+	for hour := 6; hour < 20; hour++ {
+		// Bell shaped production over the day
+		power := 250 - (hour-13)*(hour-13)*5
+		s := testSnapshot(day.Add(time.Duration(hour) * time.Hour))
+		s.ArrayInfo.Timestamp = s.CollectedAt
+		for i := range s.ArrayInfo.Inverters {
+			inv := &s.ArrayInfo.Inverters[i]
+			inv.PowerA, inv.PowerB, inv.PowerC, inv.PowerD = power, power, power, power
+		}
+		s.ArrayInfo.Inverters[0].PowerD = int(float64(power) * fraction)
+		snapshots = append(snapshots, s)
+	}
+	return snapshots
+}
+
+func TestAnalyzePanels(t *testing.T) {
+	reports := AnalyzePanels(panelSnapshots(0.5), DefaultPanelAnalysisOptions())
+	require.Len(t, reports, 8)
+
+	for _, r := range reports {
+		if r.InverterID == "801000030000" && r.Channel == "D" {
+			require.True(t, r.Underperforming)
+			require.InDelta(t, 0.5, r.InverterRatio, 0.02)
+			require.Less(t, r.ArrayRatio, 0.6)
+			require.Equal(t, 1.0, r.BelowThreshold)
+			continue
+		}
+		require.False(t, r.Underperforming, "%s/%s", r.InverterID, r.Channel)
+	}
+}
+
+func TestAnalyzePanelsHealthy(t *testing.T) {
+	for _, r := range AnalyzePanels(panelSnapshots(0.95), DefaultPanelAnalysisOptions()) {
+		require.False(t, r.Underperforming)
+	}
+}
@@ -0,0 +1,216 @@
+package ecur
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIPrefix is the path under which APIHandler serves its endpoints
+const APIPrefix = "/api/v1/"
+
+// JSONEvent is the JSON representation of an Event
+type JSONEvent struct {
+	Type       EventType   `json:"type"`
+	Time       time.Time   `json:"time"`
+	EcuID      string      `json:"ecu_id"`
+	InverterID string      `json:"inverter_id,omitempty"`
+	Before     interface{} `json:"before"`
+	After      interface{} `json:"after"`
+}
+
+// JSONEnergy is the production of the current ECU day, with one sample per
+// ECU timestamp collected so far
+type JSONEnergy struct {
+	EcuID            string        `json:"ecu_id"`
+	Date             string        `json:"date"`
+	TodayEnergyWh    int           `json:"today_energy_wh"`
+	LifetimeEnergyWh int           `json:"lifetime_energy_wh"`
+	Samples          []PowerSample `json:"samples"`
+}
+
+func NewJSONEvent(e Event) JSONEvent {
+	return JSONEvent{
+		Type:       e.Type,
+		Time:       e.Time,
+		EcuID:      e.EcuID,
+		InverterID: e.InverterID,
+		Before:     e.Before,
+		After:      e.After,
+	}
+}
+
+// APIHandler serves the cached data of the collectors as JSON:
+//
+//	/api/v1/ecus                          ECU level data of every ECU-R
+//	/api/v1/ecus/{id}                     latest snapshot
+//	/api/v1/ecus/{id}/inverters           all inverters
+//	/api/v1/ecus/{id}/inverters/{inv}     a single inverter
+//	/api/v1/ecus/{id}/energy              production of the current day
+//	/api/v1/ecus/{id}/events              recent events
+//	/api/v1/ecus/{id}/roof.svg            heatmap of the roof layout, with
+//	                                      ?value=current (default) or today
+//	/api/v1/stream                        new snapshots and events, as
+//	                                      Server-Sent Events or WebSocket
+//
+// Requests never reach the ECU-R. Responses carry an ETag, a hash of the
+// body, and, except for events, a Last-Modified header with the collection
+// time of the latest snapshot, so clients can use conditional requests
+func APIHandler(collectors ...*Collector) http.Handler {
+	return &apiHandler{collectors: collectors}
+}
+
+type apiHandler struct {
+	collectors []*Collector
+}
+
+func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, APIPrefix), "/"), "/")
+	if len(parts) == 1 && parts[0] == "stream" {
+		h.serveStream(w, r)
+		return
+	}
+	if parts[0] != "ecus" {
+		apiError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if len(parts) == 1 {
+		h.serveECUs(w, r)
+		return
+	}
+
+	c, s, ok := h.find(parts[1])
+	if !ok {
+		apiError(w, http.StatusNotFound, fmt.Sprintf("unknown ECU-R %q", parts[1]))
+		return
+	}
+	// collected_at, clock_offset_s and stale change with every poll
+	modified := s.CollectedAt
+
+	switch {
+	case len(parts) == 2:
+		serveJSON(w, r, NewJSONDocument(s, false), modified)
+	case len(parts) == 3 && parts[2] == "inverters":
+		serveJSON(w, r, NewJSONDocument(s, false).Inverters, modified)
+	case len(parts) == 4 && parts[2] == "inverters":
+		for _, inv := range NewJSONDocument(s, false).Inverters {
+			if inv.InverterID == parts[3] {
+				serveJSON(w, r, inv, modified)
+				return
+			}
+		}
+		apiError(w, http.StatusNotFound, fmt.Sprintf("unknown inverter %q", parts[3]))
+	case len(parts) == 3 && parts[2] == "energy":
+		serveJSON(w, r, JSONEnergy{
+			EcuID:            s.ECUInfo.EcuID,
+			Date:             s.ArrayInfo.Timestamp.Format("2006-01-02"),
+			TodayEnergyWh:    s.ECUInfo.TodayEnergy,
+			LifetimeEnergyWh: s.ECUInfo.LifetimeEnergy,
+			Samples:          append([]PowerSample{}, c.Today()...),
+		}, modified)
+	case len(parts) == 3 && parts[2] == "roof.svg":
+		h.serveRoof(w, r, c, s)
+	case len(parts) == 3 && parts[2] == "events":
+		events, _ := c.RecentEvents()
+		out := []JSONEvent{}
+		for _, e := range events {
+			out = append(out, NewJSONEvent(e))
+		}
+		// Events arrive between polls, so there is no modification time
+		serveJSON(w, r, out, time.Time{})
+	default:
+		apiError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *apiHandler) serveECUs(w http.ResponseWriter, r *http.Request) {
+	ecus := []JSONECU{}
+	var modified time.Time
+	for _, c := range h.collectors {
+		s, ok := c.Latest()
+		if !ok {
+			continue
+		}
+		ecus = append(ecus, NewJSONDocument(s, false).ECU)
+		if s.CollectedAt.After(modified) {
+			modified = s.CollectedAt
+		}
+	}
+	serveJSON(w, r, ecus, modified)
+}
+
+func (h *apiHandler) serveRoof(w http.ResponseWriter, r *http.Request, c *Collector, s Snapshot) {
+	if c.Layout == nil {
+		apiError(w, http.StatusNotFound, "no roof layout configured")
+		return
+	}
+
+	var values map[PanelID]float64
+	opts := HeatmapOptions{}
+	switch value := r.URL.Query().Get("value"); value {
+	case "", "current":
+		values, opts.Unit = ChannelPower(s), "W"
+	case "today":
+		values, opts.Unit = c.TodayChannelEnergy(), "Wh"
+	default:
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("unknown value %q, use current or today", value))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := RenderHeatmapSVG(&buf, *c.Layout, values, opts); err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	serveBody(w, r, "image/svg+xml", buf.Bytes(), s.CollectedAt)
+}
+
+// find returns the collector whose latest snapshot belongs to the ECU-R
+func (h *apiHandler) find(ecuID string) (*Collector, Snapshot, bool) {
+	for _, c := range h.collectors {
+		if s, ok := c.Latest(); ok && s.ECUInfo.EcuID == ecuID {
+			return c, s, true
+		}
+	}
+	return nil, Snapshot{}, false
+}
+
+// serveJSON writes v as JSON and answers conditional requests with 304 Not
+// Modified. A zero modification time omits the Last-Modified header
+func serveJSON(w http.ResponseWriter, r *http.Request, v interface{}, modified time.Time) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	serveBody(w, r, "application/json", body, modified)
+}
+
+func serveBody(w http.ResponseWriter, r *http.Request, contentType string, body []byte, modified time.Time) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", etag(body))
+	http.ServeContent(w, r, "", modified, bytes.NewReader(body))
+}
+
+func apiError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// etag returns a strong entity tag for the body
+func etag(body []byte) string {
+	h := fnv.New64a()
+	h.Write(body)
+	return fmt.Sprintf(`"%x"`, h.Sum64())
+}
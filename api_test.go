@@ -0,0 +1,124 @@
+package ecur
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testAPICollector(t *testing.T) *Collector {
+	first := testSnapshot(time.Now()).ECUResponse
+	second := testSnapshot(time.Now()).ECUResponse
+	second.ArrayInfo.Inverters[1].Online = false
+
+	c := NewCollector(&fakeSource{responses: []ECUResponse{first, second}}, time.Minute)
+	_, err := c.Poll()
+	require.NoError(t, err)
+	_, err = c.Poll()
+	require.NoError(t, err)
+	return c
+}
+
+func TestAPIHandler(t *testing.T) {
+	c := testAPICollector(t)
+	s, _ := c.Latest()
+	srv := httptest.NewServer(APIHandler(c))
+	defer srv.Close()
+
+	get := func(path string, v interface{}) *http.Response {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp
+	}
+
+	var ecus []JSONECU
+	resp := get("/api/v1/ecus", &ecus)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, ecus, 1)
+	require.Equal(t, s.ECUInfo.EcuID, ecus[0].EcuID)
+
+	var doc JSONDocument
+	resp = get("/api/v1/ecus/216000011111", &doc)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.Equal(t, s.CollectedAt.UTC().Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+	require.Len(t, doc.Inverters, 2)
+
+	var inv JSONInverter
+	resp = get("/api/v1/ecus/216000011111/inverters/801000030001", &inv)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "801000030001", inv.InverterID)
+	require.False(t, inv.Online)
+
+	var events []JSONEvent
+	resp = get("/api/v1/ecus/216000011111/events", &events)
+	require.Empty(t, resp.Header.Get("Last-Modified"))
+	require.Len(t, events, 1)
+	require.Equal(t, EventInverterOffline, events[0].Type)
+
+	var energy JSONEnergy
+	get("/api/v1/ecus/216000011111/energy", &energy)
+	require.Len(t, energy.Samples, 1)
+	require.Equal(t, s.ECUInfo.TodayEnergy, energy.TodayEnergyWh)
+
+	require.Equal(t, http.StatusNotFound, get("/api/v1/ecus/1", nil).StatusCode)
+	require.Equal(t, http.StatusNotFound, get("/api/v1/ecus/216000011111/inverters/1", nil).StatusCode)
+	require.Equal(t, http.StatusNotFound, get("/api/v1/other", nil).StatusCode)
+}
+
+func TestAPIHandlerConditional(t *testing.T) {
+	srv := httptest.NewServer(APIHandler(testAPICollector(t)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/ecus/216000011111")
+	require.NoError(t, err)
+	resp.Body.Close()
+	tag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	require.NotEmpty(t, tag)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/ecus/216000011111", nil)
+	req.Header.Set("If-None-Match", tag)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/api/v1/ecus/216000011111", nil)
+	req.Header.Set("If-Modified-Since", modified)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotModified, resp.StatusCode)
+}
+
+func TestAPIHandlerConditionalChangedBody(t *testing.T) {
+	c := testAPICollector(t)
+	srv := httptest.NewServer(APIHandler(c))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/ecus/216000011111")
+	require.NoError(t, err)
+	resp.Body.Close()
+	tag := resp.Header.Get("ETag")
+
+	// The same ECU timestamp, but a new collection time
+	time.Sleep(time.Millisecond)
+	_, err = c.Poll()
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/ecus/216000011111", nil)
+	req.Header.Set("If-None-Match", tag)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotEqual(t, tag, resp.Header.Get("ETag"))
+}
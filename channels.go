@@ -0,0 +1,47 @@
+package ecur
+
+// Channel is a single DC input of an inverter. On a QS1 every channel is
+// connected to exactly one panel
+type Channel struct {
+	Name  string // A, B, C or D
+	Power int    // in W
+}
+
+// Channels returns the channels available on the inverter model. YC600
+// inverters have two channels, QS1 and YC1000 inverters have four
+func (i InverterInfo) Channels() []Channel {
+	channels := []Channel{
+		{Name: "A", Power: i.PowerA},
+		{Name: "B", Power: i.PowerB},
+		{Name: "C", Power: i.PowerC},
+		{Name: "D", Power: i.PowerD},
+	}
+	if i.Model == "YC600" {
+		return channels[:2]
+	}
+	return channels
+}
+
+// TotalPower returns the summed power of all channels (in W)
+func (i InverterInfo) TotalPower() int {
+	total := 0
+	for _, ch := range i.Channels() {
+		total += ch.Power
+	}
+	return total
+}
+
+// Signal returns the raw zigbee signal strength (0-255) for the given inverter
+func (r ECUResponse) Signal(inverterID string) (int, bool) {
+	for _, s := range r.InverterSignalInfo.Inverters {
+		if s.ID == inverterID {
+			return s.Signal, true
+		}
+	}
+	return 0, false
+}
+
+// SignalPercent converts a raw zigbee signal strength (0-255) to a percentage
+func SignalPercent(signal int) float64 {
+	return float64(signal) / 2.56
+}
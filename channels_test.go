@@ -0,0 +1,28 @@
+package ecur
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannels(t *testing.T) {
+	qs1 := InverterInfo{Model: "QS1", PowerA: 1, PowerB: 2, PowerC: 3, PowerD: 4}
+	require.Len(t, qs1.Channels(), 4)
+	require.Equal(t, 10, qs1.TotalPower())
+
+	yc600 := InverterInfo{Model: "YC600", PowerA: 1, PowerB: 2}
+	require.Equal(t, []Channel{{"A", 1}, {"B", 2}}, yc600.Channels())
+	require.Equal(t, 3, yc600.TotalPower())
+}
+
+func TestSignal(t *testing.T) {
+	resp := ECUResponse{InverterSignalInfo: InverterSignalInfo{Inverters: []InverterSignal{{ID: "801000030000", Signal: 128}}}}
+	signal, ok := resp.Signal("801000030000")
+	require.True(t, ok)
+	require.Equal(t, 128, signal)
+	require.Equal(t, 50.0, SignalPercent(signal))
+
+	_, ok = resp.Signal("801000030001")
+	require.False(t, ok)
+}
@@ -1,6 +1,8 @@
 package ecur
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
@@ -16,17 +18,65 @@ type Client struct {
 
 	ecuID string
 	tz    string
+
+	// Locating the ECU-R by ID (see WithExpectedID)
+	expectedID string
+	cachePath  string
+	networks   []*net.IPNet
+}
+
+// ClientOption configures optional behaviour of a Client
+type ClientOption func(*Client)
+
+// WithExpectedID makes the client refuse ECU-Rs with a different ECU ID.
+// When the ECU-R can not be reached on its address, or another ECU-R answers,
+// the client searches the local network for the expected ECU-R
+func WithExpectedID(ecuID string) ClientOption {
+	return func(c *Client) {
+		c.expectedID = ecuID
+	}
+}
+
+// WithAddressCache keeps the last known address of the expected ECU-R in
+// the given file. The cached address takes precedence over the configured one
+func WithAddressCache(path string) ClientOption {
+	return func(c *Client) {
+		c.cachePath = path
+	}
+}
+
+// WithDiscoveryNetworks sets the networks that are searched for the expected
+// ECU-R. By default the networks of the local interfaces are searched
+func WithDiscoveryNetworks(networks []*net.IPNet) ClientOption {
+	return func(c *Client) {
+		c.networks = networks
+	}
 }
 
-func NewClient(ip string, port int, tz string) (*Client, error) {
-	return &Client{
+func NewClient(ip string, port int, tz string, opts ...ClientOption) (*Client, error) {
+	c := &Client{
 		ip:       ip,
 		port:     strconv.Itoa(port),
 		cooldown: time.Millisecond * time.Duration(25),
 		conn:     nil,
 		ecuID:    "",
 		tz:       tz,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.expectedID != "" && c.cachePath != "" {
+		if addr, ok := loadCachedAddress(c.cachePath, c.expectedID); ok {
+			c.ip = addr
+		}
+	}
+	return c, nil
+}
+
+// Address returns the address the client connects to
+func (c *Client) Address() string {
+	return c.ip
 }
 
 func (c *Client) GetData() (ECUResponse, error) {
@@ -38,6 +88,17 @@ func (c *Client) GetData() (ECUResponse, error) {
 
 	// Get ECU-R information
 	ecuInfo, err := c.GetECUInfo()
+	if errors.Is(err, ErrECUIDMismatch) {
+		// Another ECU-R took over the address of the expected one
+		c.Close()
+		if err := c.relocate(); err != nil {
+			return ECUResponse{}, fmt.Errorf("could not locate ECU: %w", err)
+		}
+		if err := c.dial(); err != nil {
+			return ECUResponse{}, fmt.Errorf("could not connect to ECU: %w", err)
+		}
+		ecuInfo, err = c.GetECUInfo()
+	}
 	if err != nil {
 		return ECUResponse{ECUInfo: ecuInfo}, fmt.Errorf("could not get ECU information: %w", err)
 	}
@@ -70,9 +131,23 @@ func (c *Client) GetData() (ECUResponse, error) {
 	}, nil
 }
 
-// connects with the ECU-R, but does not send further data
+// connects with the ECU-R, but does not send further data. If the ECU-R
+// can not be reached and an expected ECU ID is set, the ECU-R is searched
+// for on the local network
 func (c *Client) Connect() error {
-	conn, err := net.Dial("tcp", c.ip+":"+c.port)
+	err := c.dial()
+	if err == nil || c.expectedID == "" {
+		return err
+	}
+
+	if rerr := c.relocate(); rerr != nil {
+		return fmt.Errorf("%v; could not locate ECU: %w", err, rerr)
+	}
+	return c.dial()
+}
+
+func (c *Client) dial() error {
+	conn, err := net.Dial("tcp", net.JoinHostPort(c.ip, c.port))
 	if err != nil {
 		return err
 	}
@@ -80,6 +155,36 @@ func (c *Client) Connect() error {
 	return nil
 }
 
+// relocate searches the local network for the expected ECU-R and stores
+// its address
+func (c *Client) relocate() error {
+	networks := c.networks
+	if networks == nil {
+		local, err := LocalNetworks()
+		if err != nil {
+			return err
+		}
+		networks, _ = ScannableNetworks(local)
+	}
+
+	opts := DefaultDiscoverOptions()
+	opts.Port, _ = strconv.Atoi(c.port)
+	found, err := Discover(context.Background(), networks, opts)
+	if err != nil {
+		return err
+	}
+	for _, ecu := range found {
+		if ecu.ECUInfo.EcuID == c.expectedID {
+			c.ip = ecu.Address
+			if c.cachePath != "" {
+				return saveCachedAddress(c.cachePath, c.expectedID, c.ip)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("ECU %s not found on %v: %w", c.expectedID, networks, ErrCouldNotConnect)
+}
+
 // Close closes the connection to the ECU-R
 // typically called after collecing all data
 func (c *Client) Close() error {
@@ -108,6 +213,10 @@ func (c *Client) GetECUInfo() (ECUInfo, error) {
 		return ECUInfo{Raw: raw}, err
 	}
 
+	if c.expectedID != "" && ecuInfo.EcuID != c.expectedID {
+		return ECUInfo{Raw: raw}, fmt.Errorf("expected ECU %s at %s, got %s: %w", c.expectedID, c.ip, ecuInfo.EcuID, ErrECUIDMismatch)
+	}
+
 	return ecuInfo, nil
 }
 
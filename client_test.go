@@ -1,7 +1,9 @@
 package ecur
 
 import (
+	"net"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -44,3 +46,41 @@ func TestClientGetData(t *testing.T) {
 	_, err = c.GetData()
 	require.NoError(t, err)
 }
+
+func TestClientRelocatesExpectedECU(t *testing.T) {
+	port := fakeECU(t, "127.0.0.1")
+	_, network, err := net.ParseCIDR("127.0.0.0/30")
+	require.NoError(t, err)
+	cache := filepath.Join(t.TempDir(), "addresses.json")
+
+	// Nothing listens on 127.0.0.2, the ECU is found on 127.0.0.1 instead
+	c, err := NewClient("127.0.0.2", port, "UTC",
+		WithExpectedID("216000011111"),
+		WithAddressCache(cache),
+		WithDiscoveryNetworks([]*net.IPNet{network}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, c.Connect())
+	defer c.Close()
+	require.Equal(t, "127.0.0.1", c.Address())
+
+	info, err := c.GetECUInfo()
+	require.NoError(t, err)
+	require.Equal(t, "216000011111", info.EcuID)
+
+	// The next client starts from the cached address
+	c, err = NewClient("127.0.0.2", port, "UTC", WithExpectedID("216000011111"), WithAddressCache(cache))
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", c.Address())
+}
+
+func TestClientRefusesOtherECU(t *testing.T) {
+	port := fakeECU(t, "127.0.0.1")
+	c, err := NewClient("127.0.0.1", port, "UTC", WithExpectedID("216000099999"))
+	require.NoError(t, err)
+	require.NoError(t, c.Connect())
+	defer c.Close()
+
+	_, err = c.GetECUInfo()
+	require.ErrorIs(t, err, ErrECUIDMismatch)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/hectormalot/ecur"
+	"github.com/spf13/cobra"
+)
+
+var alertCmd = &cobra.Command{
+	Use:   "alert",
+	Short: "Poll the APS ECU-R and report alerts based on a rules file",
+	Long: `Alert polls the ECU-R at a fixed interval and evaluates the rules
+from the provided YAML file. Alerts are printed once when they start
+firing and once when they are resolved.`,
+	Run: RunAlerts,
+}
+
+func RunAlerts(cmd *cobra.Command, args []string) {
+	rules, err := ecur.LoadAlertRules(rulesFile)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+	engine, err := ecur.NewAlertEngine(rules)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		log.Fatal("Error:", err)
+	}
+	collector := newCollector(c, interval)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		snapshot, ok, err := poll(collector)
+		if err != nil {
+			log.Println("Error: ", err)
+		}
+		if ok {
+			for _, alert := range engine.Evaluate(snapshot) {
+				fmt.Println(alert)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
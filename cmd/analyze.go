@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/hectormalot/ecur"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Analyze collected ECU-R data",
+	Long: `Analyze reads previously collected snapshots (e.g. the appended
+output of 'aps get --json') and reports on the performance of the array.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var analyzePanelsCmd = &cobra.Command{
+	Use:   "panels",
+	Short: "Detect panels that consistently underperform their siblings",
+	Run:   AnalyzePanels,
+}
+
+func AnalyzePanels(cmd *cobra.Command, args []string) {
+	snapshots, err := loadSnapshots(inputFile)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+
+	opts := ecur.DefaultPanelAnalysisOptions()
+	opts.Threshold = threshold
+	reports := ecur.AnalyzePanels(snapshots, opts)
+
+	if outputJson {
+		printJSON(reports)
+		return
+	}
+
+	data := pterm.TableData{{"Inverter", "Channel", "Samples", "vs Inverter", "vs Array", "Below threshold", "Status"}}
+	for _, r := range reports {
+		status := "ok"
+		if r.Underperforming {
+			status = pterm.Red("underperforming")
+		}
+		data = append(data, []string{
+			r.InverterID,
+			r.Channel,
+			fmt.Sprint(r.Samples),
+			fmt.Sprintf("%.0f%%", r.InverterRatio*100),
+			fmt.Sprintf("%.0f%%", r.ArrayRatio*100),
+			fmt.Sprintf("%.0f%%", r.BelowThreshold*100),
+			status,
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
+
+// loadSnapshots reads snapshots from a file, or from stdin if path is "-"
+func loadSnapshots(path string) ([]ecur.Snapshot, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return ecur.ReadSnapshots(r)
+}
+
+var analyzeShadingCmd = &cobra.Command{
+	Use:   "shading",
+	Short: "Detect recurring time of day dips per panel, grouped by month",
+	Run:   AnalyzeShading,
+}
+
+func AnalyzeShading(cmd *cobra.Command, args []string) {
+	if slotSize <= 0 {
+		log.Fatal("Error: --slot must be positive")
+	}
+	snapshots, err := loadSnapshots(inputFile)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+
+	opts := ecur.DefaultShadingOptions()
+	opts.SlotSize = slotSize
+	reports, err := ecur.DetectShading(snapshots, opts)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+
+	if outputJson {
+		printJSON(reports)
+		return
+	}
+
+	data := pterm.TableData{{"Inverter", "Channel", "Month", "Window", "Loss", "Days"}}
+	for _, r := range reports {
+		for _, m := range r.Months {
+			for _, w := range m.Windows {
+				data = append(data, []string{
+					r.InverterID,
+					r.Channel,
+					m.Month,
+					w.String(),
+					fmt.Sprintf("%.0f%%", w.Depth*100),
+					fmt.Sprint(w.Days),
+				})
+			}
+		}
+	}
+	if len(data) == 1 {
+		pterm.Info.Println("No recurring shading detected")
+		return
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
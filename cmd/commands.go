@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/hectormalot/ecur"
 	"github.com/pterm/pterm"
@@ -29,14 +32,32 @@ func Execute() {
 	}
 }
 
+// newClient creates a client from the global flags
+func newClient() (*ecur.Client, error) {
+	var opts []ecur.ClientOption
+	if ecuID != "" {
+		opts = append(opts, ecur.WithExpectedID(ecuID))
+		if addressCache != "" {
+			opts = append(opts, ecur.WithAddressCache(addressCache))
+		}
+	}
+	return ecur.NewClient(host, port, tz, opts...)
+}
+
 var getCmd = &cobra.Command{
-	Use:   "get",
-	Short: "Get data from APS ECU-R",
-	Run:   GetData,
+	Use:         "get",
+	Short:       "Get data from APS ECU-R",
+	Run:         GetData,
+	Annotations: map[string]string{annotationAll: "true"},
 }
 
 func GetData(cmd *cobra.Command, args []string) {
-	c, err := ecur.NewClient(host, port, tz)
+	if allECUs {
+		GetFleet()
+		return
+	}
+
+	c, err := newClient()
 	if err != nil {
 		log.Fatal("Error:", err)
 	}
@@ -46,15 +67,123 @@ func GetData(cmd *cobra.Command, args []string) {
 		log.Fatal("Error: ", err)
 	}
 
+	PrintData(EcuData)
+}
+
+// GetFleet reads all ECU-Rs from the configuration file concurrently. The
+// table output is a summary per site, other formats print every site in full
+func GetFleet() {
+	var sites []ecur.Site
+	for _, t := range targets {
+		c, err := newClientFor(t)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		sites = append(sites, ecur.Site{Name: t.Name, Source: c})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fleetTimeout)
+	defer cancel()
+	res := ecur.NewFleet(fleetConcurrency, sites...).Poll(ctx)
+
+	for _, site := range res.Sites {
+		if site.Err != nil {
+			log.Printf("Error: %s: %s", site.Name, site.Err)
+		}
+	}
+
 	if outputJson {
-		PrintJSON(EcuData)
-		return
+		outputFormat = "json"
+	}
+	if templateText == "" && templateFile == "" {
+		switch outputFormat {
+		case "table":
+			pterm.DefaultTable.WithHasHeader().WithData(fleetTableData(res)).Render()
+			return
+		case "csv", "tsv":
+			// One header for all sites
+			var snapshots []ecur.Snapshot
+			for _, site := range res.Sites {
+				if site.Err == nil {
+					snapshots = append(snapshots, site.Snapshot)
+				}
+			}
+			comma := ','
+			if outputFormat == "tsv" {
+				comma = '\t'
+			}
+			printCSV(comma, snapshots...)
+			return
+		}
+	}
+	for _, site := range res.Sites {
+		if site.Err == nil {
+			PrintData(site.Snapshot.ECUResponse)
+		}
+	}
+}
+
+func fleetTableData(res ecur.FleetResult) pterm.TableData {
+	data := pterm.TableData{{"Site", "ECU ID", "Power (W)", "Today (kWh)", "Inverters online", "Last update"}}
+	for _, site := range res.Sites {
+		if site.Err != nil {
+			data = append(data, []string{site.Name, "", "", "", "", pterm.Red("unavailable")})
+			continue
+		}
+		info := site.Snapshot.ECUInfo
+		data = append(data, []string{
+			site.Name,
+			info.EcuID,
+			fmt.Sprint(info.LastPower),
+			fmt.Sprintf("%.3f", float64(info.TodayEnergy)/1000),
+			fmt.Sprintf("%d/%d", info.InvertersOnline, info.InvertersRegistered),
+			site.Snapshot.ArrayInfo.Timestamp.Format("2006-01-02 15:04:05"),
+		})
+	}
+	t := res.Totals
+	return append(data, []string{
+		fmt.Sprintf("Total (%d/%d sites)", t.Sites-t.SitesFailed, t.Sites),
+		"",
+		fmt.Sprint(t.Power),
+		fmt.Sprintf("%.3f", float64(t.TodayEnergy)/1000),
+		fmt.Sprintf("%d/%d", t.InvertersOnline, t.InvertersRegistered),
+		"",
+	})
+}
+
+// PrintData prints the data in the format selected with --output
+func PrintData(EcuData ecur.ECUResponse) {
+	if outputJson {
+		outputFormat = "json"
+	}
+	if templateText != "" || templateFile != "" {
+		outputFormat = "template"
 	}
 
-	PrintTable(EcuData)
+	switch outputFormat {
+	case "json":
+		PrintJSON(EcuData)
+	case "influx":
+		PrintInflux(EcuData)
+	case "csv":
+		PrintCSV(EcuData, ',')
+	case "tsv":
+		PrintCSV(EcuData, '\t')
+	case "template":
+		PrintTemplate(EcuData)
+	case "table":
+		PrintTable(EcuData)
+	default:
+		log.Fatalf("Error: unknown output format %q", outputFormat)
+	}
 }
 
+// PrintJSON prints the data in the versioned JSON format (see 'aps schema')
 func PrintJSON(data ecur.ECUResponse) {
+	printJSON(ecur.NewJSONDocument(ecur.NewSnapshot(data, time.Now()), includeRaw))
+}
+
+func printJSON(data interface{}) {
 	output, err := json.Marshal(data)
 	if err != nil {
 		log.Fatal("Error: ", err)
@@ -62,10 +191,81 @@ func PrintJSON(data ecur.ECUResponse) {
 	fmt.Println(string(output))
 }
 
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the JSON output",
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Stdout.Write(ecur.JSONSchema)
+	},
+}
+
+func PrintInflux(data ecur.ECUResponse) {
+	err := ecur.WriteLineProtocol(os.Stdout, ecur.NewSnapshot(data, time.Now()), influxPrecision)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+}
+
+// PrintCSV prints one row per inverter channel. The header is omitted when
+// stdout is appended to a file that already has content (e.g. aps get >> log.csv)
+func PrintCSV(data ecur.ECUResponse, comma rune) {
+	printCSV(comma, ecur.NewSnapshot(data, time.Now()))
+}
+
+func printCSV(comma rune, snapshots ...ecur.Snapshot) {
+	header := true
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode().IsRegular() && info.Size() > 0 {
+		header = false
+	}
+
+	w := ecur.NewCSVWriter(os.Stdout, comma, header)
+	for _, s := range snapshots {
+		if err := w.Write(s); err != nil {
+			log.Fatal("Error: ", err)
+		}
+	}
+}
+
+// PrintTemplate renders the data with the template from --template or
+// --template-file, followed by a newline if the template did not end with one
+func PrintTemplate(data ecur.ECUResponse) {
+	text := templateText
+	if templateFile != "" {
+		body, err := os.ReadFile(templateFile)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		text = string(body)
+	}
+
+	tmpl, err := ecur.NewTemplate("output", text)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Fatal("Error: ", err)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	os.Stdout.Write(buf.Bytes())
+}
+
 func PrintTable(data ecur.ECUResponse) {
 	// ECU information
 	pterm.DefaultSection.Println("ECU information:")
-	pterm.DefaultTable.WithHasHeader().WithData(pterm.TableData{
+	pterm.DefaultTable.WithHasHeader().WithData(ecuTableData(data)).Render()
+
+	// Array information
+	for n, i := range data.ArrayInfo.Inverters {
+		pterm.DefaultSection.WithLevel(2).Printf("Inverter %s", inverterName(i.ID))
+		pterm.DefaultTable.WithHasHeader().WithData(inverterTableData(data, n)).Render()
+	}
+}
+
+func ecuTableData(data ecur.ECUResponse) pterm.TableData {
+	return pterm.TableData{
 		{"Parameter", "Value", "Unit"},
 		{"ECU ID", data.ECUInfo.EcuID, ""},
 		{"Software version", data.ECUInfo.Version, ""},
@@ -76,23 +276,22 @@ func PrintTable(data ecur.ECUResponse) {
 		{"Ethernet MAC", data.ECUInfo.EthernetMac, ""},
 		{"WiFi MAC", data.ECUInfo.WirelessMac, ""},
 		{"Last update", data.ArrayInfo.Timestamp.Format("2006-01-02 15:04:05"), ""},
-	}).Render()
+	}
+}
 
-	// Array information
-	for n, i := range data.ArrayInfo.Inverters {
-		pterm.DefaultSection.WithLevel(2).Printf("Inverter %s", i.ID)
-
-		pterm.DefaultTable.WithHasHeader().WithData(pterm.TableData{
-			{"Parameter", "Value", "Unit"},
-			{"Model", i.Model, ""},
-			{"Signal", fmt.Sprintf("%.1f", float64(data.InverterSignalInfo.Inverters[n].Signal)/2.56), "%"},
-			{"Frequency", fmt.Sprintf("%.2f", i.Frequency), "Hz"},
-			{"Voltage", fmt.Sprint(i.VoltageA), "V"},
-			{"Temperature", fmt.Sprint(i.Temperature), "Celsius"},
-			{"PowerA", fmt.Sprint(i.PowerA), "W"},
-			{"PowerB", fmt.Sprint(i.PowerB), "W"},
-			{"PowerC", fmt.Sprint(i.PowerC), "W"},
-			{"PowerD", fmt.Sprint(i.PowerD), "W"},
-		}).Render()
+func inverterTableData(data ecur.ECUResponse, n int) pterm.TableData {
+	i := data.ArrayInfo.Inverters[n]
+	signal, _ := data.Signal(i.ID)
+	return pterm.TableData{
+		{"Parameter", "Value", "Unit"},
+		{"Model", i.Model, ""},
+		{"Signal", fmt.Sprintf("%.1f", ecur.SignalPercent(signal)), "%"},
+		{"Frequency", fmt.Sprintf("%.2f", i.Frequency), "Hz"},
+		{"Voltage", fmt.Sprint(i.VoltageA), "V"},
+		{"Temperature", fmt.Sprint(i.Temperature), "Celsius"},
+		{"PowerA", fmt.Sprint(i.PowerA), "W"},
+		{"PowerB", fmt.Sprint(i.PowerB), "W"},
+		{"PowerC", fmt.Sprint(i.PowerC), "W"},
+		{"PowerD", fmt.Sprint(i.PowerD), "W"},
 	}
 }
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hectormalot/ecur"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the (optional) configuration file of the aps command, by default
+// located at $XDG_CONFIG_HOME/aps/config.yaml
+type Config struct {
+	// Default is the ECU used when no --ecu is given
+	Default string               `yaml:"default"`
+	ECUs    map[string]ECUConfig `yaml:"ecus"`
+	// Sinks holds flag defaults per sink command (mqtt, influx), e.g.
+	// sinks: {mqtt: {broker: tcp://nas:1883, username: aps}}
+	Sinks map[string]map[string]string `yaml:"sinks"`
+}
+
+// ECUConfig describes a single, named ECU-R
+type ECUConfig struct {
+	Address string `yaml:"address"`
+	Port    int    `yaml:"port"`
+	TZ      string `yaml:"tz"`
+	EcuID   string `yaml:"ecu_id"`
+	// Inverters maps inverter IDs to friendly names
+	Inverters map[string]string `yaml:"inverters"`
+	// Layout places the panels on the roof, for aps render and the dashboard
+	Layout *ecur.RoofLayout `yaml:"layout"`
+}
+
+// annotationAll marks commands that support --all
+const annotationAll = "all"
+
+// target is a named ECU-R selected on the command line
+type target struct {
+	Name string
+	ECUConfig
+}
+
+var (
+	config Config
+	// targets holds the ECUs selected with --all
+	targets []target
+	// aliases maps inverter IDs to the names from the configuration
+	aliases = map[string]string{}
+	// layout is the roof layout of the selected ECU, if configured
+	layout *ecur.RoofLayout
+)
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "aps", "config.yaml")
+}
+
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+	body, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := yaml.Unmarshal(body, &cfg); err != nil {
+		return cfg, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// applyConfig runs before every command. Flag values are resolved in order
+// of precedence: command line, environment (APS_<FLAG>), configuration file
+// and finally the flag defaults
+func applyConfig(cmd *cobra.Command, args []string) error {
+	if env, ok := os.LookupEnv("APS_CONFIG"); ok && !cmd.Flags().Changed("config") {
+		configPath = env
+	}
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	config = cfg
+
+	if env, ok := os.LookupEnv("APS_ECU"); ok && !cmd.Flags().Changed("ecu") {
+		ecuName = env
+	}
+	if env, ok := os.LookupEnv("APS_ALL"); ok && !cmd.Flags().Changed("all") {
+		all, err := strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("invalid value for APS_ALL: %w", err)
+		}
+		allECUs = all
+	}
+
+	if allECUs {
+		if cmd.Annotations[annotationAll] == "" {
+			return fmt.Errorf("%s does not support --all", cmd.Name())
+		}
+		if len(cfg.ECUs) == 0 {
+			return fmt.Errorf("--all requires ECUs in the configuration file (%s)", configPath)
+		}
+		for _, name := range sortedECUNames(cfg) {
+			t := target{Name: name, ECUConfig: cfg.ECUs[name]}
+			targets = append(targets, t)
+			for id, alias := range t.Inverters {
+				aliases[id] = alias
+			}
+		}
+	} else if ecu, ok, err := selectECU(cfg); err != nil {
+		return err
+	} else if ok {
+		setFlagDefault(cmd, "host", ecu.Address)
+		setFlagDefault(cmd, "tz", ecu.TZ)
+		setFlagDefault(cmd, "ecu-id", ecu.EcuID)
+		if ecu.Port != 0 {
+			setFlagDefault(cmd, "port", strconv.Itoa(ecu.Port))
+		}
+		for id, alias := range ecu.Inverters {
+			aliases[id] = alias
+		}
+		layout = ecu.Layout
+	}
+
+	for name, value := range cfg.Sinks[cmd.Name()] {
+		setFlagDefault(cmd, name, value)
+	}
+
+	// Environment variables override the configuration file
+	var envErr error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		env := "APS_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(env); ok && !f.Changed {
+			if err := f.Value.Set(value); err != nil && envErr == nil {
+				envErr = fmt.Errorf("invalid value for %s: %w", env, err)
+			}
+		}
+	})
+	return envErr
+}
+
+// selectECU returns the ECU selected with --ecu, the default ECU, or the
+// only ECU in the configuration
+func selectECU(cfg Config) (ECUConfig, bool, error) {
+	name := ecuName
+	if name == "" {
+		name = cfg.Default
+	}
+	if name == "" && len(cfg.ECUs) == 1 {
+		name = sortedECUNames(cfg)[0]
+	}
+	if name == "" {
+		return ECUConfig{}, false, nil
+	}
+	ecu, ok := cfg.ECUs[name]
+	if !ok {
+		return ECUConfig{}, false, fmt.Errorf("unknown ECU %q, configured ECUs: %s", name, strings.Join(sortedECUNames(cfg), ", "))
+	}
+	return ecu, true, nil
+}
+
+// setFlagDefault sets a flag that was not given on the command line
+func setFlagDefault(cmd *cobra.Command, name, value string) {
+	f := cmd.Flags().Lookup(name)
+	if f == nil || f.Changed || value == "" {
+		return
+	}
+	f.Value.Set(value)
+}
+
+func sortedECUNames(cfg Config) []string {
+	var names []string
+	for name := range cfg.ECUs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newClientFor creates a client for a configured ECU-R
+func newClientFor(t target) (*ecur.Client, error) {
+	p, zone := t.Port, t.TZ
+	if p == 0 {
+		p = ecur.DefaultPort
+	}
+	if zone == "" {
+		zone = ecur.DefaultTz
+	}
+	var opts []ecur.ClientOption
+	if t.EcuID != "" {
+		opts = append(opts, ecur.WithExpectedID(t.EcuID))
+		if addressCache != "" {
+			opts = append(opts, ecur.WithAddressCache(addressCache))
+		}
+	}
+	return ecur.NewClient(t.Address, p, zone, opts...)
+}
+
+// inverterName returns the inverter ID, followed by its alias if configured
+func inverterName(id string) string {
+	if alias, ok := aliases[id]; ok {
+		return fmt.Sprintf("%s (%s)", id, alias)
+	}
+	return id
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+default: home
+ecus:
+  home:
+    address: 192.168.1.10
+    tz: Europe/Amsterdam
+  cabin:
+    address: 10.0.0.20
+    port: 8900
+sinks:
+  test:
+    broker: tcp://nas:1883
+`
+
+// testCommand returns a command with the flags used by applyConfig, reset
+// to their defaults, and parses the arguments
+func testCommand(t *testing.T, args ...string) *cobra.Command {
+	cmd := &cobra.Command{Use: "test", Annotations: map[string]string{annotationAll: "true"}}
+	cmd.Flags().StringVar(&configPath, "config", "", "")
+	cmd.Flags().StringVarP(&ecuName, "ecu", "e", "", "")
+	cmd.Flags().BoolVar(&allECUs, "all", false, "")
+	cmd.Flags().StringVarP(&host, "host", "a", "localhost", "")
+	cmd.Flags().IntVarP(&port, "port", "p", 8899, "")
+	cmd.Flags().StringVar(&tz, "tz", "UTC", "")
+	cmd.Flags().StringVar(&ecuID, "ecu-id", "", "")
+	cmd.Flags().StringVar(&mqttBroker, "broker", "tcp://localhost:1883", "")
+	require.NoError(t, cmd.ParseFlags(args))
+
+	targets = nil
+	aliases = map[string]string{}
+	return cmd
+}
+
+func TestApplyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testConfig), 0o644))
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		host    string
+		port    int
+		tz      string
+		broker  string
+		targets int
+	}{
+		{
+			name: "defaults without configuration",
+			args: []string{"--config", filepath.Join(t.TempDir(), "missing.yaml")},
+			host: "localhost", port: 8899, tz: "UTC", broker: "tcp://localhost:1883",
+		},
+		{
+			name: "default ECU from the configuration",
+			args: []string{"--config", path},
+			host: "192.168.1.10", port: 8899, tz: "Europe/Amsterdam", broker: "tcp://nas:1883",
+		},
+		{
+			name: "ECU selected with a flag",
+			args: []string{"--config", path, "--ecu", "cabin"},
+			host: "10.0.0.20", port: 8900, tz: "UTC", broker: "tcp://nas:1883",
+		},
+		{
+			name: "ECU selected with the environment",
+			args: []string{"--config", path},
+			env:  map[string]string{"APS_ECU": "cabin"},
+			host: "10.0.0.20", port: 8900, tz: "UTC", broker: "tcp://nas:1883",
+		},
+		{
+			name: "configuration file from the environment",
+			env:  map[string]string{"APS_CONFIG": path},
+			host: "192.168.1.10", port: 8899, tz: "Europe/Amsterdam", broker: "tcp://nas:1883",
+		},
+		{
+			name: "environment overrides the configuration",
+			args: []string{"--config", path},
+			env:  map[string]string{"APS_HOST": "192.168.1.99", "APS_BROKER": "tcp://env:1883"},
+			host: "192.168.1.99", port: 8899, tz: "Europe/Amsterdam", broker: "tcp://env:1883",
+		},
+		{
+			name: "flags override the environment",
+			args: []string{"--config", path, "--host", "192.168.1.50", "--ecu", "home"},
+			env:  map[string]string{"APS_HOST": "192.168.1.99", "APS_ECU": "cabin"},
+			host: "192.168.1.50", port: 8899, tz: "Europe/Amsterdam", broker: "tcp://nas:1883",
+		},
+		{
+			name: "all ECUs with a flag",
+			args: []string{"--config", path, "--all"},
+			host: "localhost", port: 8899, tz: "UTC", broker: "tcp://nas:1883", targets: 2,
+		},
+		{
+			name: "all ECUs with the environment",
+			args: []string{"--config", path},
+			env:  map[string]string{"APS_ALL": "1"},
+			host: "localhost", port: 8899, tz: "UTC", broker: "tcp://nas:1883", targets: 2,
+		},
+		{
+			name: "flag overrides all ECUs from the environment",
+			args: []string{"--config", path, "--all=false"},
+			env:  map[string]string{"APS_ALL": "true"},
+			host: "192.168.1.10", port: 8899, tz: "Europe/Amsterdam", broker: "tcp://nas:1883",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			cmd := testCommand(t, tt.args...)
+			require.NoError(t, applyConfig(cmd, nil))
+			require.Equal(t, tt.host, host)
+			require.Equal(t, tt.port, port)
+			require.Equal(t, tt.tz, tz)
+			require.Equal(t, tt.broker, mqttBroker)
+			require.Len(t, targets, tt.targets)
+		})
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testConfig), 0o644))
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{name: "unknown ECU", args: []string{"--config", path, "--ecu", "garage"}},
+		{name: "invalid APS_ALL", args: []string{"--config", path}, env: map[string]string{"APS_ALL": "sometimes"}},
+		{name: "invalid flag value", args: []string{"--config", path}, env: map[string]string{"APS_PORT": "http"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			require.Error(t, applyConfig(testCommand(t, tt.args...), nil))
+		})
+	}
+}
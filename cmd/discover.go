@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/hectormalot/ecur"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var discoverCmd = &cobra.Command{
+	Use:   "discover [CIDR...]",
+	Short: "Find ECU-R devices on the local network",
+	Long: `Discover scans the given networks (e.g. 192.168.1.0/24), or the
+networks of the local interfaces if none are given, for ECU-R devices.
+Local networks larger than a /16 are skipped. Every host that accepts a
+connection is confirmed with an ECU information request before it is
+listed.`,
+	Run: RunDiscover,
+}
+
+func RunDiscover(cmd *cobra.Command, args []string) {
+	var networks []*net.IPNet
+	for _, arg := range args {
+		_, network, err := net.ParseCIDR(arg)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		networks = append(networks, network)
+	}
+	if len(networks) == 0 {
+		local, err := ecur.LocalNetworks()
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		var tooLarge []*net.IPNet
+		networks, tooLarge = ecur.ScannableNetworks(local)
+		for _, n := range tooLarge {
+			pterm.Warning.Printfln("Skipping %s: too large to scan, pass a smaller network to scan it", n)
+		}
+	}
+
+	opts := ecur.DiscoverOptions{
+		Port:        port,
+		Timeout:     discoverTimeout,
+		Concurrency: discoverConcurrency,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Scanning %v on port %d", networks, port))
+	found, err := ecur.Discover(ctx, networks, opts)
+	spinner.Stop()
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+
+	if outputJson {
+		printJSON(found)
+		return
+	}
+	if len(found) == 0 {
+		pterm.Info.Println("No ECU-R devices found")
+		return
+	}
+
+	data := pterm.TableData{{"Address", "ECU ID", "Software version", "Inverters"}}
+	for _, ecu := range found {
+		data = append(data, []string{
+			ecu.Address,
+			ecu.ECUInfo.EcuID,
+			ecu.ECUInfo.Version,
+			fmt.Sprintf("%d/%d", ecu.ECUInfo.InvertersOnline, ecu.ECUInfo.InvertersRegistered),
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hectormalot/ecur"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var gapsCmd = &cobra.Command{
+	Use:   "gaps",
+	Short: "List the gaps in the local history",
+	Long: `Gaps lists the periods without readings in the local history (see
+--store), for example because aps was not running. Nights, without
+production on either side of the gap, are not listed. Commands that keep
+polling report the gap since their previous run with the first reading.`,
+	Run: Gaps,
+}
+
+func Gaps(cmd *cobra.Command, args []string) {
+	st, err := ecur.OpenStore(storeDir)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+	from, err := parseQueryTime(queryFrom, loc)
+	if err != nil {
+		log.Fatal("Error: invalid --from: ", err)
+	}
+	to, err := parseQueryTime(queryTo, loc)
+	if err != nil {
+		log.Fatal("Error: invalid --to: ", err)
+	}
+
+	gaps, err := findGaps(st, from, to)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+	if outputJson {
+		printJSON(gaps)
+		return
+	}
+	data := pterm.TableData{{"ECU", "From", "To", "Duration"}}
+	for _, g := range gaps {
+		data = append(data, []string{
+			g.EcuID,
+			g.From.Format("2006-01-02 15:04"),
+			g.To.Format("2006-01-02 15:04"),
+			g.Duration().String(),
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
+
+// findGaps returns the gaps of the ECU-R selected with --ecu-id, or of all
+// ECU-Rs in the store
+func findGaps(st *ecur.Store, from, to time.Time) ([]ecur.Gap, error) {
+	ecus := []string{ecuID}
+	if ecuID == "" {
+		var err error
+		if ecus, err = st.ECUs(); err != nil {
+			return nil, err
+		}
+	}
+	var gaps []ecur.Gap
+	for _, id := range ecus {
+		g, err := st.Gaps(id, from, to, gapThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("could not find gaps of %s: %w", id, err)
+		}
+		gaps = append(gaps, g...)
+	}
+	return gaps, nil
+}
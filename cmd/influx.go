@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/hectormalot/ecur"
+	"github.com/spf13/cobra"
+)
+
+var influxCmd = &cobra.Command{
+	Use:   "influx",
+	Short: "Poll the APS ECU-R and write the results to InfluxDB",
+	Long: `Influx polls the ECU-R at a fixed interval and writes every reading
+to the InfluxDB v2 write API. Points are timestamped with the ECU timestamp,
+so polls of unchanged ECU data overwrite the existing points.`,
+	Run: RunInflux,
+}
+
+func RunInflux(cmd *cobra.Command, args []string) {
+	sink := ecur.NewInfluxSink(ecur.InfluxOptions{
+		URL:         influxURL,
+		Org:         influxOrg,
+		Bucket:      influxBucket,
+		Token:       influxToken,
+		Precision:   influxPrecision,
+		BatchSize:   influxBatchSize,
+		MaxBuffered: influxMaxBuffered,
+	})
+
+	c, err := newClient()
+	if err != nil {
+		log.Fatal("Error:", err)
+	}
+	collector := newCollector(c, interval)
+	collector.AddSink(sink)
+	collector.OnError = func(err error) {
+		log.Print("Error: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	collector.Run(ctx)
+
+	if err := sink.Flush(); err != nil {
+		log.Print("Error: ", err)
+	}
+}
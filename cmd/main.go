@@ -1,25 +1,176 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"time"
+
 	"github.com/hectormalot/ecur"
 )
 
 // used for flags
 var (
-	outputJson bool
-	host       string
-	port       int
-	tz         string
+	outputJson   bool
+	outputFormat string
+	templateText string
+	templateFile string
+	includeRaw   bool
+	host         string
+	port         int
+	tz           string
+	ecuID        string
+	addressCache string
+	configPath   string
+	ecuName      string
+	allECUs      bool
+	interval     time.Duration
+	rulesFile    string
+	inputFile    string
+	threshold    float64
+	slotSize     time.Duration
+	metricsAddr  string
+	httpAddr     string
+
+	mqttBroker          string
+	mqttUsername        string
+	mqttPassword        string
+	mqttCAFile          string
+	mqttInsecure        bool
+	mqttTopicPrefix     string
+	mqttDiscoveryPrefix string
+
+	influxURL         string
+	influxOrg         string
+	influxBucket      string
+	influxToken       string
+	influxPrecision   string
+	influxBatchSize   int
+	influxMaxBuffered int
+
+	discoverTimeout     time.Duration
+	discoverConcurrency int
+
+	fleetConcurrency int
+	fleetTimeout     time.Duration
+
+	svgFile     string
+	renderValue string
+	renderInput string
+	renderDate  string
+
+	storeDir  string
+	retention time.Duration
+
+	queryFrom     string
+	queryTo       string
+	queryInverter string
+	queryChannel  string
+	queryAgg      string
+	queryFunc     string
+
+	gapThreshold time.Duration
+
+	// watch has its own interval: every registration of a flag writes its
+	// default to the variable, so a shared variable ends up with the last
+	watchInterval time.Duration
 )
 
 func main() {
 	Execute()
 }
 
+func defaultAddressCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "aps", "addresses.json")
+}
+
 func init() {
+	rootCmd.PersistentPreRunE = applyConfig
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", defaultConfigPath(), "Configuration file")
+	rootCmd.PersistentFlags().StringVarP(&ecuName, "ecu", "e", "", "Name of the ECU-R from the configuration file")
+	rootCmd.PersistentFlags().BoolVar(&allECUs, "all", false, "Use all ECU-Rs from the configuration file")
 	rootCmd.PersistentFlags().StringVarP(&host, "host", "a", "localhost", "ECU-R address")
 	rootCmd.PersistentFlags().StringVar(&tz, "tz", ecur.DefaultTz, "IANA timezone of the ECU-R (used to parse the provided timestamp)")
 	rootCmd.PersistentFlags().IntVarP(&port, "port", "p", ecur.DefaultPort, "Port on which to connect with ECU-R")
+	rootCmd.PersistentFlags().StringVar(&ecuID, "ecu-id", "", "Expected ECU ID; other ECU-Rs are refused and the ECU-R is searched for on the local network when unreachable")
+	rootCmd.PersistentFlags().StringVar(&addressCache, "address-cache", defaultAddressCache(), "File with the last known address per ECU ID")
 	rootCmd.PersistentFlags().BoolVarP(&outputJson, "json", "j", false, "Output results as JSON")
+	rootCmd.PersistentFlags().StringVar(&storeDir, "store", defaultStorePath(), "Directory of the local history ('' to disable)")
+	rootCmd.PersistentFlags().DurationVar(&retention, "retention", ecur.DefaultRetention, "Period to keep raw readings in the local history for, older data is kept as rollups (0 keeps everything)")
+	getCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format: table, json, influx, csv or tsv")
+	getCmd.Flags().StringVar(&influxPrecision, "precision", ecur.DefaultInfluxPrecision, "Timestamp precision for influx output: ns, us, ms or s")
+	getCmd.Flags().StringVar(&templateText, "template", "", "Go text/template to render the output with")
+	getCmd.Flags().StringVar(&templateFile, "template-file", "", "File with a Go text/template to render the output with")
+	getCmd.Flags().BoolVar(&includeRaw, "raw", false, "Include the raw ECU-R responses (hex encoded) in JSON output")
+	getCmd.Flags().IntVar(&fleetConcurrency, "concurrency", ecur.DefaultFleetConcurrency, "Number of ECU-Rs to read at the same time with --all")
+	getCmd.Flags().DurationVar(&fleetTimeout, "timeout", 30*time.Second, "Maximum time to wait for all ECU-Rs with --all")
 	rootCmd.AddCommand(getCmd)
+	rootCmd.AddCommand(schemaCmd)
+
+	alertCmd.Flags().StringVarP(&rulesFile, "rules", "r", "alerts.yaml", "YAML file with alert rules")
+	alertCmd.Flags().DurationVarP(&interval, "interval", "i", time.Minute, "Interval between polls of the ECU-R")
+	rootCmd.AddCommand(alertCmd)
+
+	analyzeCmd.PersistentFlags().StringVarP(&inputFile, "input", "f", "-", "File with collected snapshots as JSON ('-' for stdin)")
+	analyzePanelsCmd.Flags().Float64Var(&threshold, "threshold", ecur.DefaultPanelAnalysisOptions().Threshold, "Ratio to sibling channels below which a panel underperforms")
+	analyzeCmd.AddCommand(analyzePanelsCmd)
+	analyzeShadingCmd.Flags().DurationVar(&slotSize, "slot", ecur.DefaultShadingOptions().SlotSize, "Time of day resolution of the production profile")
+	analyzeCmd.AddCommand(analyzeShadingCmd)
+	rootCmd.AddCommand(analyzeCmd)
+
+	serveCmd.Flags().StringVar(&metricsAddr, "metrics", "", "Address to serve Prometheus metrics on (e.g. :9100)")
+	serveCmd.Flags().StringVar(&httpAddr, "http", "", "Address to serve the JSON API on (e.g. :8080)")
+	serveCmd.Flags().DurationVarP(&interval, "interval", "i", time.Minute, "Interval between polls of the ECU-R")
+	rootCmd.AddCommand(serveCmd)
+
+	watchCmd.Flags().DurationVarP(&watchInterval, "interval", "i", 30*time.Second, "Interval between polls of the ECU-R")
+	rootCmd.AddCommand(watchCmd)
+
+	mqttCmd.Flags().StringVar(&mqttBroker, "broker", "tcp://localhost:1883", "MQTT broker URL (tcp:// or ssl://)")
+	mqttCmd.Flags().StringVar(&mqttUsername, "username", "", "MQTT username")
+	mqttCmd.Flags().StringVar(&mqttPassword, "password", "", "MQTT password")
+	mqttCmd.Flags().StringVar(&mqttCAFile, "ca-file", "", "PEM encoded CA certificate to verify the broker with")
+	mqttCmd.Flags().BoolVar(&mqttInsecure, "insecure", false, "Skip verification of the broker certificate")
+	mqttCmd.Flags().StringVar(&mqttTopicPrefix, "topic-prefix", ecur.DefaultMQTTTopicPrefix, "Prefix for all state topics")
+	mqttCmd.Flags().StringVar(&mqttDiscoveryPrefix, "discovery-prefix", ecur.DefaultMQTTDiscoveryPrefix, "Home Assistant discovery prefix (empty to disable)")
+	mqttCmd.Flags().DurationVarP(&interval, "interval", "i", time.Minute, "Interval between polls of the ECU-R")
+	rootCmd.AddCommand(mqttCmd)
+
+	influxCmd.Flags().StringVar(&influxURL, "url", "http://localhost:8086", "InfluxDB URL")
+	influxCmd.Flags().StringVar(&influxOrg, "org", "", "InfluxDB organization")
+	influxCmd.Flags().StringVar(&influxBucket, "bucket", "", "InfluxDB bucket")
+	influxCmd.Flags().StringVar(&influxToken, "token", os.Getenv("INFLUX_TOKEN"), "InfluxDB API token (defaults to $INFLUX_TOKEN)")
+	influxCmd.Flags().StringVar(&influxPrecision, "precision", ecur.DefaultInfluxPrecision, "Timestamp precision: ns, us, ms or s")
+	influxCmd.Flags().IntVar(&influxBatchSize, "batch", ecur.DefaultInfluxBatchSize, "Number of readings to write per request")
+	influxCmd.Flags().IntVar(&influxMaxBuffered, "max-buffered", ecur.DefaultInfluxMaxBuffered, "Number of readings to keep while InfluxDB is unreachable, older readings are dropped")
+	influxCmd.Flags().DurationVarP(&interval, "interval", "i", time.Minute, "Interval between polls of the ECU-R")
+	rootCmd.AddCommand(influxCmd)
+
+	discoverCmd.Flags().DurationVar(&discoverTimeout, "timeout", ecur.DefaultDiscoverOptions().Timeout, "Timeout per host")
+	discoverCmd.Flags().IntVar(&discoverConcurrency, "concurrency", ecur.DefaultDiscoverOptions().Concurrency, "Number of hosts to probe at the same time")
+	rootCmd.AddCommand(discoverCmd)
+
+	renderCmd.Flags().StringVar(&svgFile, "svg", "", "Render as SVG to this file ('-' or no value for stdout)")
+	renderCmd.Flags().Lookup("svg").NoOptDefVal = "-"
+	renderCmd.Flags().StringVar(&renderValue, "value", "current", "Value to colour the panels by: current (power) or today (energy)")
+	renderCmd.Flags().StringVarP(&renderInput, "input", "f", "", "File with collected snapshots as JSON ('-' for stdin)")
+	renderCmd.Flags().StringVar(&renderDate, "date", "", "Day to render with --value today (YYYY-MM-DD)")
+	rootCmd.AddCommand(renderCmd)
+
+	queryCmd.Flags().StringVar(&queryFrom, "from", "", "Start of the range (2006-01-02, 2006-01-02 15:04 or RFC 3339)")
+	queryCmd.Flags().StringVar(&queryTo, "to", "", "End of the range, exclusive")
+	queryCmd.Flags().StringVar(&queryInverter, "inverter", "", "Inverter ID or name from the configuration file (default all)")
+	queryCmd.Flags().StringVar(&queryChannel, "channel", "", "Channel, e.g. A (default all)")
+	queryCmd.Flags().StringVar(&queryAgg, "agg", "", "Aggregation interval, e.g. 15m, 1h or 7d (default the whole range)")
+	queryCmd.Flags().StringVar(&queryFunc, "func", string(ecur.AggAvg), "Aggregation: avg or max (power in W) or sum (energy in Wh)")
+	queryCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format: table, json, csv or tsv")
+	rootCmd.AddCommand(queryCmd)
+
+	gapsCmd.Flags().StringVar(&queryFrom, "from", "", "Start of the range (2006-01-02, 2006-01-02 15:04 or RFC 3339)")
+	gapsCmd.Flags().StringVar(&queryTo, "to", "", "End of the range, exclusive")
+	gapsCmd.Flags().DurationVar(&gapThreshold, "threshold", ecur.DefaultGapThreshold, "Shortest period without readings to report")
+	rootCmd.AddCommand(gapsCmd)
 }
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntervalDefaults(t *testing.T) {
+	// Registered by init for all commands
+	require.Equal(t, 30*time.Second, watchInterval)
+	require.Equal(t, time.Minute, interval)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+
+	"github.com/hectormalot/ecur"
+	"github.com/spf13/cobra"
+)
+
+var mqttCmd = &cobra.Command{
+	Use:   "mqtt",
+	Short: "Poll the APS ECU-R and publish the results to an MQTT broker",
+	Long: `MQTT polls the ECU-R at a fixed interval and publishes every reading
+as retained per-entity topics. Home Assistant discovery configurations are
+published as well, so the ECU, inverters and channels show up as devices.`,
+	Run: RunMQTT,
+}
+
+func RunMQTT(cmd *cobra.Command, args []string) {
+	opts := ecur.MQTTOptions{
+		Broker:          mqttBroker,
+		Username:        mqttUsername,
+		Password:        mqttPassword,
+		TopicPrefix:     mqttTopicPrefix,
+		DiscoveryPrefix: mqttDiscoveryPrefix,
+	}
+	if mqttCAFile != "" || mqttInsecure {
+		cfg, err := mqttTLSConfig()
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		opts.TLSConfig = cfg
+	}
+	publisher := ecur.NewMQTTPublisher(opts)
+	if err := publisher.Connect(); err != nil {
+		log.Fatal("Error: ", err)
+	}
+	defer publisher.Close()
+
+	c, err := newClient()
+	if err != nil {
+		log.Fatal("Error:", err)
+	}
+	collector := newCollector(c, interval)
+	collector.AddSink(publisher)
+	collector.OnError = func(err error) {
+		log.Print("Error: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	collector.Run(ctx)
+}
+
+func mqttTLSConfig() (*tls.Config, error) {
+	u, err := url.Parse(mqttBroker)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: mqttInsecure,
+	}
+	if mqttCAFile != "" {
+		pem, err := os.ReadFile(mqttCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		cfg.RootCAs.AppendCertsFromPEM(pem)
+	}
+	return cfg, nil
+}
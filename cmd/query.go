@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hectormalot/ecur"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var queryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Query the local history",
+	Long: `Query aggregates the power of the channels in the local history (see
+--store) per interval. --func avg and max give the average and highest
+power in W, sum gives the energy produced in Wh. Without --agg, the whole
+range is aggregated. For example, the peak of a panel in June:
+
+  aps query --from 2021-06-01 --to 2021-07-01 --inverter 801000030000 --channel A --func max
+
+Periods of which the raw readings have been removed (see --retention) are
+answered from the hourly rollups.`,
+	Run: Query,
+}
+
+func Query(cmd *cobra.Command, args []string) {
+	st, err := ecur.OpenStore(storeDir)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+
+	q := ecur.Query{EcuID: ecuID, InverterID: inverterID(queryInverter), Channel: queryChannel}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+	if q.From, err = parseQueryTime(queryFrom, loc); err != nil {
+		log.Fatal("Error: invalid --from: ", err)
+	}
+	if q.To, err = parseQueryTime(queryTo, loc); err != nil {
+		log.Fatal("Error: invalid --to: ", err)
+	}
+	agg, err := parseInterval(queryAgg)
+	if err != nil {
+		log.Fatal("Error: invalid --agg: ", err)
+	}
+
+	points, err := st.Aggregate(q, agg, ecur.AggFunc(queryFunc))
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+
+	unit := "W"
+	if ecur.AggFunc(queryFunc) == ecur.AggSum {
+		unit = "Wh"
+	}
+	if outputJson {
+		outputFormat = "json"
+	}
+	switch outputFormat {
+	case "json":
+		printJSON(points)
+	case "csv", "tsv":
+		w := csv.NewWriter(os.Stdout)
+		if outputFormat == "tsv" {
+			w.Comma = '\t'
+		}
+		w.Write([]string{"start", "ecu_id", "inverter_id", "channel", queryFunc + "_" + strings.ToLower(unit), "samples"})
+		for _, p := range points {
+			w.Write([]string{
+				p.Start.Format(time.RFC3339),
+				p.EcuID,
+				p.InverterID,
+				p.Channel,
+				strconv.FormatFloat(p.Value, 'f', 1, 64),
+				strconv.Itoa(p.Samples),
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			log.Fatal("Error: ", err)
+		}
+	case "table":
+		data := pterm.TableData{{"Start", "Inverter", "Channel", fmt.Sprintf("%s (%s)", queryFunc, unit), "Samples"}}
+		for _, p := range points {
+			data = append(data, []string{
+				p.Start.Format("2006-01-02 15:04"),
+				inverterName(p.InverterID),
+				p.Channel,
+				fmt.Sprintf("%.1f", p.Value),
+				fmt.Sprint(p.Samples),
+			})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+	default:
+		log.Fatalf("Error: unknown output format %q", outputFormat)
+	}
+}
+
+// inverterID resolves an inverter name from the configuration file to its ID
+func inverterID(name string) string {
+	for id, alias := range aliases {
+		if alias == name {
+			return id
+		}
+	}
+	return name
+}
+
+// parseQueryTime parses a date, a date and time or an RFC 3339 timestamp.
+// Dates and times without offset are in the time zone of the ECU-R
+func parseQueryTime(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date (2006-01-02), date and time (2006-01-02 15:04) or RFC 3339 timestamp", value)
+}
+
+// parseInterval parses a duration, which may also be given in days (7d)
+func parseInterval(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number of days", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
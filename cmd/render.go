@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/hectormalot/ecur"
+	"github.com/spf13/cobra"
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render a heatmap of the panels on the roof",
+	Long: `Render draws the roof layout from the configuration file, with every
+panel coloured by its output. With --value current the current power is
+read from the ECU-R (or from the last snapshot of --input); with --value
+today the energy of every panel is integrated from the snapshots in
+--input, for the day of --date (default: the last day in the input).
+
+A file name must be attached to the flag: --svg=roof.svg.`,
+	Args: cobra.NoArgs,
+	Run:  Render,
+}
+
+func Render(cmd *cobra.Command, args []string) {
+	if svgFile == "" {
+		log.Fatal("Error: provide --svg (optionally with a file name)")
+	}
+	if layout == nil {
+		log.Fatal("Error: no roof layout configured for this ECU-R, add a layout to the configuration file")
+	}
+	if err := layout.Validate(); err != nil {
+		log.Fatal("Error: invalid roof layout: ", err)
+	}
+
+	var values map[ecur.PanelID]float64
+	opts := ecur.HeatmapOptions{}
+	switch renderValue {
+	case "current":
+		s, err := currentSnapshot()
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		values, opts.Unit = ecur.ChannelPower(s), "W"
+		opts.Title = fmt.Sprintf("%s, %s", s.ECUInfo.EcuID, s.ArrayInfo.Timestamp.Format("2006-01-02 15:04"))
+	case "today":
+		if renderInput == "" {
+			log.Fatal("Error: --value today requires collected snapshots, provide --input")
+		}
+		snapshots, err := loadSnapshots(renderInput)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		day, snapshots := snapshotsOfDay(snapshots, renderDate)
+		if len(snapshots) == 0 {
+			log.Fatal("Error: no snapshots found for ", day)
+		}
+		values, opts.Unit = ecur.ChannelEnergy(snapshots), "Wh"
+		opts.Title = fmt.Sprintf("%s, %s", snapshots[0].ECUInfo.EcuID, day)
+	default:
+		log.Fatalf("Error: unknown value %q, use current or today", renderValue)
+	}
+
+	var w io.Writer = os.Stdout
+	if svgFile != "-" {
+		f, err := os.Create(svgFile)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := ecur.RenderHeatmapSVG(w, *layout, values, opts); err != nil {
+		log.Fatal("Error: ", err)
+	}
+}
+
+// currentSnapshot returns the last snapshot of --input, or reads the ECU-R
+func currentSnapshot() (ecur.Snapshot, error) {
+	if renderInput != "" {
+		snapshots, err := loadSnapshots(renderInput)
+		if err != nil {
+			return ecur.Snapshot{}, err
+		}
+		if len(snapshots) == 0 {
+			return ecur.Snapshot{}, fmt.Errorf("no snapshots in %s", renderInput)
+		}
+		return snapshots[len(snapshots)-1], nil
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return ecur.Snapshot{}, err
+	}
+	resp, err := c.GetData()
+	if err != nil {
+		return ecur.Snapshot{}, err
+	}
+	return ecur.NewSnapshot(resp, time.Now()), nil
+}
+
+// snapshotsOfDay returns the snapshots with an ECU timestamp on the given
+// day (YYYY-MM-DD), or on the last day in the input when day is empty
+func snapshotsOfDay(snapshots []ecur.Snapshot, day string) (string, []ecur.Snapshot) {
+	if day == "" {
+		for _, s := range snapshots {
+			if d := s.ArrayInfo.Timestamp.Format("2006-01-02"); d > day {
+				day = d
+			}
+		}
+	}
+	var selected []ecur.Snapshot
+	for _, s := range snapshots {
+		if s.ArrayInfo.Timestamp.Format("2006-01-02") == day {
+			selected = append(selected, s)
+		}
+	}
+	return day, selected
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/hectormalot/ecur"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Poll the APS ECU-R in the background and serve the results",
+	Long: `Serve polls the ECU-R at a fixed interval and serves the latest
+snapshot. Requests are answered from the cached snapshot, so clients
+never trigger additional reads from the ECU-R.
+
+With --http, a dashboard is served on / and a JSON API under /api/v1/:
+
+  /api/v1/ecus                          ECU level data of every ECU-R
+  /api/v1/ecus/{id}                     latest snapshot
+  /api/v1/ecus/{id}/inverters           all inverters
+  /api/v1/ecus/{id}/inverters/{inv}     a single inverter
+  /api/v1/ecus/{id}/energy              production of the current day
+  /api/v1/ecus/{id}/events              recent events
+  /api/v1/ecus/{id}/roof.svg            heatmap of the roof layout, with
+                                        ?value=current (default) or today
+  /api/v1/stream                        new snapshots and events, as
+                                        Server-Sent Events or WebSocket
+
+Use --all to serve every ECU-R from the configuration file.`,
+	Annotations: map[string]string{annotationAll: "true"},
+	Run:         Serve,
+}
+
+func Serve(cmd *cobra.Command, args []string) {
+	if metricsAddr == "" && httpAddr == "" {
+		log.Fatal("Error: nothing to serve, provide --metrics and/or --http")
+	}
+
+	var collectors []*ecur.Collector
+	if allECUs {
+		if metricsAddr != "" && len(targets) > 1 {
+			log.Fatal("Error: --metrics supports a single ECU-R, use --http with --all")
+		}
+		for _, t := range targets {
+			c, err := newClientFor(t)
+			if err != nil {
+				log.Fatal("Error: ", err)
+			}
+			collectors = append(collectors, newServeCollector(t.Name, c, t.Layout))
+		}
+	} else {
+		c, err := newClient()
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		collectors = append(collectors, newServeCollector("", c, layout))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for _, collector := range collectors {
+		go collector.Run(ctx)
+	}
+
+	// --metrics and --http may share an address
+	muxes := map[string]*http.ServeMux{}
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if metricsAddr != "" {
+		mux(metricsAddr).Handle("/metrics", ecur.MetricsHandler(collectors[0]))
+		log.Printf("Serving metrics on %s/metrics", metricsAddr)
+	}
+	if httpAddr != "" {
+		mux(httpAddr).Handle(ecur.APIPrefix, ecur.APIHandler(collectors...))
+		mux(httpAddr).Handle("/", ecur.DashboardHandler())
+		log.Printf("Serving the dashboard on %s and the API on %s%s", httpAddr, httpAddr, strings.TrimSuffix(ecur.APIPrefix, "/"))
+	}
+
+	errs := make(chan error, len(muxes))
+	for addr, m := range muxes {
+		server := &http.Server{Addr: addr, Handler: m}
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		go func() {
+			errs <- server.ListenAndServe()
+		}()
+	}
+	for range muxes {
+		if err := <-errs; err != nil && err != http.ErrServerClosed {
+			log.Fatal("Error: ", err)
+		}
+	}
+}
+
+func newServeCollector(name string, c *ecur.Client, l *ecur.RoofLayout) *ecur.Collector {
+	if l != nil {
+		if err := l.Validate(); err != nil {
+			log.Fatal("Error: invalid roof layout: ", err)
+		}
+	}
+	collector := newCollector(c, interval)
+	collector.Layout = l
+	collector.OnError = func(err error) {
+		if name != "" {
+			log.Printf("Error: %s: %s", name, err)
+			return
+		}
+		log.Print("Error: ", err)
+	}
+	return collector
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hectormalot/ecur"
+)
+
+// history is the store opened by openStore
+var history *ecur.Store
+
+// defaultStorePath returns $XDG_DATA_HOME/aps/history, or
+// ~/.local/share/aps/history
+func defaultStorePath() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "aps", "history")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "aps", "history")
+}
+
+// openStore opens the store selected with --store once, and compacts the
+// segments left behind by earlier runs. The downtime before this run is
+// reported with the first reading of every ECU-R
+func openStore() (*ecur.Store, error) {
+	if history != nil {
+		return history, nil
+	}
+	st, err := ecur.OpenStore(storeDir)
+	if err != nil {
+		return nil, err
+	}
+	st.Retention = retention
+	st.OnGap = func(g ecur.Gap) {
+		log.Printf("Gap in history: %s", g)
+	}
+	if err := st.Compact(); err != nil {
+		return nil, err
+	}
+	history = st
+	return history, nil
+}
+
+// newCollector creates a collector for the source that also writes every
+// snapshot to the store, unless the store is disabled with --store "". A
+// store that can not be opened is reported once, and collectors run without
+func newCollector(source ecur.DataSource, interval time.Duration) *ecur.Collector {
+	collector := ecur.NewCollector(source, interval)
+	if storeDir == "" {
+		return collector
+	}
+	st, err := openStore()
+	if err != nil {
+		log.Printf("Error: local history disabled: %s", err)
+		storeDir = ""
+		return collector
+	}
+	collector.AddSink(st)
+	return collector
+}
+
+// poll polls the collector. The snapshot is valid whenever the ECU-R was
+// read, even when writing it to a sink such as the store failed
+func poll(collector *ecur.Collector) (ecur.Snapshot, bool, error) {
+	snapshot, err := collector.Poll()
+	return snapshot, !snapshot.CollectedAt.IsZero(), err
+}
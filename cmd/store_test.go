@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hectormalot/ecur"
+	"github.com/stretchr/testify/require"
+)
+
+type testSource struct {
+	err error
+}
+
+func (s testSource) GetData() (ecur.ECUResponse, error) {
+	var resp ecur.ECUResponse
+	resp.ECUInfo.EcuID = "216000011111"
+	resp.ArrayInfo.Timestamp = time.Date(2021, 10, 20, 14, 0, 0, 0, time.UTC)
+	return resp, s.err
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(ecur.Snapshot) error {
+	return errors.New("disk full")
+}
+
+func TestPoll(t *testing.T) {
+	// A failing sink does not invalidate the snapshot
+	collector := ecur.NewCollector(testSource{}, time.Minute)
+	collector.AddSink(failingSink{})
+	snapshot, ok, err := poll(collector)
+	require.Error(t, err)
+	require.True(t, ok)
+	require.Equal(t, "216000011111", snapshot.ECUInfo.EcuID)
+
+	// A failed read does
+	collector = ecur.NewCollector(testSource{err: errors.New("unreachable")}, time.Minute)
+	_, ok, err = poll(collector)
+	require.Error(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/hectormalot/ecur"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// number of polls shown in the power sparklines
+const sparklineLength = 40
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Show a live updating view of the APS ECU-R",
+	Long: `Watch polls the ECU-R at a fixed interval and re-renders the tables
+in place. Values that changed since the previous poll are highlighted.`,
+	Run: Watch,
+}
+
+func Watch(cmd *cobra.Command, args []string) {
+	c, err := newClient()
+	if err != nil {
+		log.Fatal("Error:", err)
+	}
+	collector := newCollector(c, watchInterval)
+
+	area, err := pterm.DefaultArea.Start()
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+	defer area.Stop()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var (
+		current, previous []pterm.TableData
+		history           = map[string][]int{}
+		nextPoll          time.Time
+		pollErr           error
+	)
+	for {
+		if !time.Now().Before(nextPoll) {
+			nextPoll = time.Now().Add(watchInterval)
+			snapshot, ok, err := poll(collector)
+			pollErr = err
+			if ok {
+				previous, current = current, watchTables(snapshot.ECUResponse)
+				for _, inv := range snapshot.ArrayInfo.Inverters {
+					h := append(history[inv.ID], inv.TotalPower())
+					if len(h) > sparklineLength {
+						h = h[len(h)-sparklineLength:]
+					}
+					history[inv.ID] = h
+				}
+			}
+		}
+
+		area.Update(renderWatch(collector, current, previous, history, nextPoll, pollErr))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchTables returns the ECU table followed by a table per inverter
+func watchTables(data ecur.ECUResponse) []pterm.TableData {
+	tables := []pterm.TableData{ecuTableData(data)}
+	for n := range data.ArrayInfo.Inverters {
+		tables = append(tables, inverterTableData(data, n))
+	}
+	return tables
+}
+
+func renderWatch(collector *ecur.Collector, current, previous []pterm.TableData, history map[string][]int, nextPoll time.Time, pollErr error) string {
+	var b strings.Builder
+
+	status := fmt.Sprintf("Next poll in %s", time.Until(nextPoll).Round(time.Second))
+	if snapshot, ok := collector.Latest(); ok {
+		age := time.Since(snapshot.ArrayInfo.Timestamp).Round(time.Second)
+		status = fmt.Sprintf("ECU data age %s | %s", age, status)
+		if snapshot.Stale {
+			status += " | " + pterm.Red("stale")
+		}
+	}
+	if pollErr != nil {
+		status += " | " + pterm.Red(pollErr.Error())
+	}
+	b.WriteString(status + "\n")
+
+	if len(current) == 0 {
+		return b.String()
+	}
+	snapshot, _ := collector.Latest()
+
+	b.WriteString(pterm.DefaultSection.Sprintln("ECU information:"))
+	b.WriteString(renderTable(current, previous, 0) + "\n")
+	for n, inv := range snapshot.ArrayInfo.Inverters {
+		if n+1 >= len(current) {
+			break
+		}
+		b.WriteString(pterm.DefaultSection.WithLevel(2).Sprintf("Inverter %s  %s\n", inverterName(inv.ID), sparkline(history[inv.ID])))
+		b.WriteString(renderTable(current, previous, n+1) + "\n")
+	}
+	return b.String()
+}
+
+// renderTable renders table i, highlighting cells that differ from the same
+// cell in the previous render
+func renderTable(current, previous []pterm.TableData, i int) string {
+	data := current[i]
+	if i < len(previous) {
+		data = highlightChanges(data, previous[i])
+	}
+	out, _ := pterm.DefaultTable.WithHasHeader().WithData(data).Srender()
+	return out
+}
+
+func highlightChanges(cur, prev pterm.TableData) pterm.TableData {
+	res := make(pterm.TableData, len(cur))
+	for r, row := range cur {
+		res[r] = make([]string, len(row))
+		for c, cell := range row {
+			res[r][c] = cell
+			if r < len(prev) && c < len(prev[r]) && prev[r][c] != cell {
+				res[r][c] = pterm.LightYellow(cell)
+			}
+		}
+	}
+	return res
+}
+
+// sparkline renders the values as a line of block characters, scaled
+// between zero and the maximum value
+func sparkline(values []int) string {
+	blocks := []rune("▁▂▃▄▅▆▇█")
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > 0 {
+			i = v * (len(blocks) - 1) / max
+		}
+		b.WriteRune(blocks[i])
+	}
+	return b.String()
+}
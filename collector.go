@@ -0,0 +1,268 @@
+package ecur
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultEventBuffer is the number of events the Collector buffers
+	// before dropping new ones
+	DefaultEventBuffer = 128
+	// DefaultStaleAfter is the time after which an unchanged ECU timestamp
+	// marks snapshots as stale. The ECU-R normally refreshes every 5 minutes
+	DefaultStaleAfter = 15 * time.Minute
+	// DefaultEventHistory is the number of recent events the Collector keeps
+	DefaultEventHistory = 100
+)
+
+// DataSource provides complete ECU-R readings. It is implemented by *Client
+type DataSource interface {
+	GetData() (ECUResponse, error)
+}
+
+// Sink receives every snapshot collected by a Collector
+type Sink interface {
+	Write(Snapshot) error
+}
+
+// Collector polls a DataSource at a fixed interval, caches the latest
+// snapshot and emits events describing the changes between polls
+type Collector struct {
+	source   DataSource
+	interval time.Duration
+
+	// OnError, when set, is called for every failed poll in Run
+	OnError func(error)
+	// StaleAfter is the time an unchanged ECU timestamp is accepted before
+	// snapshots are marked as stale
+	StaleAfter time.Duration
+	// Layout, when set, is the roof layout of the installation, used by
+	// APIHandler to render heatmaps
+	Layout *RoofLayout
+
+	sinks []Sink
+
+	mu     sync.RWMutex
+	latest Snapshot
+	hasRun bool
+	// first collection time at which the current ECU timestamp was seen
+	timestampSeen time.Time
+	events        chan Event
+	recent        []Event
+	eventCount    int
+	today         []PowerSample
+	todayChannels map[PanelID]float64
+	subscribers   map[int]chan<- Update
+	nextSub       int
+	now           func() time.Time
+}
+
+// Update is a new snapshot or a new event, as delivered to subscribers.
+// Exactly one of the fields is set
+type Update struct {
+	Snapshot *Snapshot
+	Event    *Event
+}
+
+// PowerSample is the ECU power and energy production at an ECU timestamp
+type PowerSample struct {
+	Time          time.Time `json:"time"`
+	PowerW        int       `json:"power_w"`
+	TodayEnergyWh int       `json:"today_energy_wh"`
+}
+
+func NewCollector(source DataSource, interval time.Duration) *Collector {
+	return &Collector{
+		source:     source,
+		interval:   interval,
+		StaleAfter: DefaultStaleAfter,
+		events:     make(chan Event, DefaultEventBuffer),
+		now:        time.Now,
+	}
+}
+
+// AddSink registers a sink that receives every successful snapshot. Sinks
+// should be added before the collector starts polling
+func (c *Collector) AddSink(s Sink) {
+	c.sinks = append(c.sinks, s)
+}
+
+// Poll reads a single snapshot from the data source and stores it as the
+// latest snapshot. Differences with the previous snapshot are published on
+// the Events() channel, after which the snapshot is written to all sinks.
+// Failed reads leave the cached snapshot untouched. When a sink fails, the
+// snapshot is returned together with the error
+func (c *Collector) Poll() (Snapshot, error) {
+	resp, err := c.source.GetData()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshot := NewSnapshot(resp, c.now())
+
+	c.mu.Lock()
+	prev, hadPrev := c.latest, c.hasRun
+
+	// Staleness: how long has the ECU been serving this timestamp
+	if !hadPrev || !prev.ArrayInfo.Timestamp.Equal(snapshot.ArrayInfo.Timestamp) {
+		c.timestampSeen = snapshot.CollectedAt
+	}
+	snapshot.StaleFor = snapshot.CollectedAt.Sub(c.timestampSeen)
+	snapshot.Stale = snapshot.StaleFor > c.StaleAfter
+
+	// Keep one sample per ECU timestamp, for the current ECU day only
+	ts := snapshot.ArrayInfo.Timestamp
+	if n := len(c.today); n == 0 || !c.today[n-1].Time.Equal(ts) {
+		if n == 0 || !sameDay(c.today[n-1].Time, ts) {
+			c.today, c.todayChannels = nil, map[PanelID]float64{}
+		} else {
+			integrateChannels(c.todayChannels, prev, snapshot)
+		}
+		c.today = append(c.today, PowerSample{Time: ts, PowerW: snapshot.ECUInfo.LastPower, TodayEnergyWh: snapshot.ECUInfo.TodayEnergy})
+	}
+
+	refreshed := !hadPrev || !prev.ArrayInfo.Timestamp.Equal(ts)
+	c.latest = snapshot
+	c.hasRun = true
+	var events []Event
+	if hadPrev {
+		events = Diff(prev, snapshot)
+		c.recent = append(c.recent, events...)
+		if len(c.recent) > DefaultEventHistory {
+			c.recent = c.recent[len(c.recent)-DefaultEventHistory:]
+		}
+		c.eventCount += len(events)
+	}
+	subscribers := make([]chan<- Update, 0, len(c.subscribers))
+	for _, ch := range c.subscribers {
+		subscribers = append(subscribers, ch)
+	}
+	c.mu.Unlock()
+
+	for _, e := range events {
+		c.publish(e)
+	}
+	for _, ch := range subscribers {
+		if refreshed {
+			notify(ch, Update{Snapshot: &snapshot})
+		}
+		for i := range events {
+			notify(ch, Update{Event: &events[i]})
+		}
+	}
+
+	// All sinks get the snapshot, even if an earlier one fails
+	var sinkErr error
+	for _, sink := range c.sinks {
+		if err := sink.Write(snapshot); err != nil && sinkErr == nil {
+			sinkErr = fmt.Errorf("could not write snapshot to sink: %w", err)
+		}
+	}
+
+	return snapshot, sinkErr
+}
+
+// Run polls immediately and then once every interval, until the context is
+// cancelled. Poll errors are passed to OnError and do not stop the loop
+func (c *Collector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.Poll(); err != nil && c.OnError != nil {
+			c.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Latest returns the most recent successful snapshot. The boolean is false
+// if no poll has succeeded yet
+func (c *Collector) Latest() (Snapshot, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.latest, c.hasRun
+}
+
+// RecentEvents returns up to DefaultEventHistory of the most recent events,
+// oldest first, and the total number of events seen since the collector
+// started
+func (c *Collector) RecentEvents() ([]Event, int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Event(nil), c.recent...), c.eventCount
+}
+
+// Today returns one sample per ECU timestamp collected during the current
+// ECU day, oldest first
+func (c *Collector) Today() []PowerSample {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]PowerSample(nil), c.today...)
+}
+
+// Subscribe delivers every snapshot with a new ECU timestamp and every event
+// on ch, until the returned function is called. Like Events(), updates are
+// dropped when ch is not ready, so ch should be buffered. A single channel
+// may subscribe to several collectors
+func (c *Collector) Subscribe(ch chan<- Update) (unsubscribe func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subscribers == nil {
+		c.subscribers = map[int]chan<- Update{}
+	}
+	id := c.nextSub
+	c.nextSub++
+	c.subscribers[id] = ch
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.subscribers, id)
+	}
+}
+
+// TodayChannelEnergy returns the energy produced by every channel during the
+// current ECU day, in Wh, as far as it was collected
+func (c *Collector) TodayChannelEnergy() map[PanelID]float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	energy := make(map[PanelID]float64, len(c.todayChannels))
+	for id, e := range c.todayChannels {
+		energy[id] = e
+	}
+	return energy
+}
+
+// Events returns the stream of events detected between consecutive polls.
+// Events are dropped when the buffer is full, so consumers should keep up
+func (c *Collector) Events() <-chan Event {
+	return c.events
+}
+
+// publish sends an event without blocking the poll loop
+func (c *Collector) publish(e Event) {
+	select {
+	case c.events <- e:
+	default:
+	}
+}
+
+func notify(ch chan<- Update, u Update) {
+	select {
+	case ch <- u:
+	default:
+	}
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,163 @@
+package ecur
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource returns the queued responses in order
+type fakeSource struct {
+	responses []ECUResponse
+	err       error
+}
+
+func (f *fakeSource) GetData() (ECUResponse, error) {
+	if f.err != nil {
+		return ECUResponse{}, f.err
+	}
+	resp := f.responses[0]
+	if len(f.responses) > 1 {
+		f.responses = f.responses[1:]
+	}
+	return resp, nil
+}
+
+func TestCollectorPoll(t *testing.T) {
+	first := testSnapshot(time.Now()).ECUResponse
+	second := testSnapshot(time.Now()).ECUResponse
+	second.ArrayInfo.Inverters = []InverterInfo{{ID: "801000030000", Online: false, Model: "QS1"}}
+
+	src := &fakeSource{responses: []ECUResponse{first, second}}
+	c := NewCollector(src, time.Minute)
+
+	_, ok := c.Latest()
+	require.False(t, ok)
+
+	// First poll has nothing to compare against
+	_, err := c.Poll()
+	require.NoError(t, err)
+	require.Len(t, c.Events(), 0)
+
+	// Second poll emits the differences
+	s, err := c.Poll()
+	require.NoError(t, err)
+	latest, ok := c.Latest()
+	require.True(t, ok)
+	require.Equal(t, s, latest)
+
+	var types []EventType
+	for len(c.Events()) > 0 {
+		types = append(types, (<-c.Events()).Type)
+	}
+	require.Equal(t, []EventType{EventInverterOffline, EventInverterRemoved}, types)
+
+	// A failed poll keeps the previous snapshot
+	src.err = errors.New("boom")
+	_, err = c.Poll()
+	require.Error(t, err)
+	latest, ok = c.Latest()
+	require.True(t, ok)
+	require.Equal(t, s, latest)
+}
+
+func TestCollectorStaleness(t *testing.T) {
+	resp := testSnapshot(time.Now()).ECUResponse
+	src := &fakeSource{responses: []ECUResponse{resp}}
+	c := NewCollector(src, time.Minute)
+	c.StaleAfter = 10 * time.Minute
+
+	now := resp.ArrayInfo.Timestamp.Add(2 * time.Minute)
+	c.now = func() time.Time { return now }
+
+	s, err := c.Poll()
+	require.NoError(t, err)
+	require.Equal(t, -2*time.Minute, s.ClockOffset)
+	require.Equal(t, time.Duration(0), s.StaleFor)
+	require.False(t, s.Stale)
+
+	// The same ECU timestamp is normal for a while
+	now = now.Add(5 * time.Minute)
+	s, err = c.Poll()
+	require.NoError(t, err)
+	require.False(t, s.Stale)
+	require.Len(t, c.Events(), 0)
+
+	// Same ECU timestamp 11 minutes later, reported once
+	now = now.Add(6 * time.Minute)
+	s, err = c.Poll()
+	require.NoError(t, err)
+	require.Equal(t, 11*time.Minute, s.StaleFor)
+	require.True(t, s.Stale)
+	require.Equal(t, EventTimestampStalled, (<-c.Events()).Type)
+	now = now.Add(time.Minute)
+	_, err = c.Poll()
+	require.NoError(t, err)
+	require.Len(t, c.Events(), 0)
+
+	// A new ECU timestamp resets the staleness
+	fresh := resp
+	fresh.ArrayInfo.Timestamp = now
+	src.responses = []ECUResponse{fresh}
+	now = now.Add(time.Minute)
+	s, err = c.Poll()
+	require.NoError(t, err)
+	require.False(t, s.Stale)
+	require.Equal(t, -time.Minute, s.ClockOffset)
+}
+
+type recordingSink struct {
+	snapshots []Snapshot
+	err       error
+}
+
+func (r *recordingSink) Write(s Snapshot) error {
+	r.snapshots = append(r.snapshots, s)
+	return r.err
+}
+
+func TestCollectorSinks(t *testing.T) {
+	src := &fakeSource{responses: []ECUResponse{testSnapshot(time.Now()).ECUResponse}}
+	c := NewCollector(src, time.Minute)
+	failing := &recordingSink{err: errors.New("sink down")}
+	ok := &recordingSink{}
+	c.AddSink(failing)
+	c.AddSink(ok)
+
+	s, err := c.Poll()
+	require.Error(t, err)
+	require.Equal(t, []Snapshot{s}, failing.snapshots)
+	require.Equal(t, []Snapshot{s}, ok.snapshots)
+
+	// The snapshot is still cached
+	_, cached := c.Latest()
+	require.True(t, cached)
+}
+
+func TestCollectorToday(t *testing.T) {
+	day := time.Date(2021, 10, 20, 14, 0, 0, 0, time.UTC)
+	var responses []ECUResponse
+	for _, ts := range []time.Time{day, day, day.Add(5 * time.Minute), day.Add(24 * time.Hour)} {
+		resp := testSnapshot(ts).ECUResponse
+		resp.ArrayInfo.Timestamp = ts
+		responses = append(responses, resp)
+	}
+	c := NewCollector(&fakeSource{responses: responses}, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		_, err := c.Poll()
+		require.NoError(t, err)
+	}
+	// Unchanged ECU timestamps are recorded once
+	require.Len(t, c.Today(), 2)
+	_, count := c.RecentEvents()
+	require.Equal(t, 0, count)
+
+	// A new ECU day starts a new series
+	_, err := c.Poll()
+	require.NoError(t, err)
+	require.Len(t, c.Today(), 1)
+	require.Equal(t, day.Add(24*time.Hour), c.Today()[0].Time)
+}
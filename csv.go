@@ -0,0 +1,69 @@
+package ecur
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSVHeader is the header of the long format CSV output: one row per
+// inverter channel. Columns are only ever added at the end
+var CSVHeader = []string{
+	"timestamp", "ecu_id", "inverter_id", "model", "channel", "online",
+	"power_w", "voltage_v", "frequency_hz", "temperature_c", "signal_pct",
+}
+
+// CSVWriter writes snapshots as CSV (or TSV) in long format. The header is
+// written before the first row only. It implements Sink
+type CSVWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVWriter returns a writer using comma as the field separator. Set
+// header to false when appending to a file that already contains a header
+func NewCSVWriter(w io.Writer, comma rune, header bool) *CSVWriter {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	return &CSVWriter{w: cw, header: header}
+}
+
+func (c *CSVWriter) Write(s Snapshot) error {
+	if c.header {
+		if err := c.w.Write(CSVHeader); err != nil {
+			return err
+		}
+		c.header = false
+	}
+
+	ts := s.ArrayInfo.Timestamp.Format(time.RFC3339)
+	for _, inv := range s.ArrayInfo.Inverters {
+		signal := ""
+		if sig, ok := s.Signal(inv.ID); ok {
+			signal = fmt.Sprintf("%.1f", SignalPercent(sig))
+		}
+		for _, ch := range inv.Channels() {
+			err := c.w.Write([]string{
+				ts,
+				s.ECUInfo.EcuID,
+				inv.ID,
+				inv.Model,
+				ch.Name,
+				strconv.FormatBool(inv.Online),
+				strconv.Itoa(ch.Power),
+				strconv.Itoa(inv.VoltageA),
+				strconv.FormatFloat(inv.Frequency, 'f', -1, 64),
+				strconv.Itoa(inv.Temperature),
+				signal,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	c.w.Flush()
+	return c.w.Error()
+}
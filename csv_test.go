@@ -0,0 +1,33 @@
+package ecur
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVWriter(t *testing.T) {
+	s := testSnapshot(time.Now())
+	s.ArrayInfo.Inverters = s.ArrayInfo.Inverters[:1]
+	s.ArrayInfo.Inverters[0].PowerA = 57
+	s.ArrayInfo.Inverters[0].Frequency = 49.9
+	s.InverterSignalInfo.Inverters = []InverterSignal{{ID: "801000030000", Signal: 128}}
+
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf, ',', true)
+	require.NoError(t, w.Write(s))
+	require.NoError(t, w.Write(s))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 9) // header only once
+	require.Equal(t, "timestamp,ecu_id,inverter_id,model,channel,online,power_w,voltage_v,frequency_hz,temperature_c,signal_pct", lines[0])
+	require.Equal(t, "2021-10-28T10:00:00Z,216000011111,801000030000,QS1,A,true,57,0,49.9,0,50.0", lines[1])
+
+	buf.Reset()
+	w = NewCSVWriter(&buf, '\t', false)
+	require.NoError(t, w.Write(s))
+	require.True(t, strings.HasPrefix(buf.String(), "2021-10-28T10:00:00Z\t216000011111\t"))
+}
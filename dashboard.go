@@ -0,0 +1,22 @@
+package ecur
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// DashboardHandler serves a single page dashboard showing the current power,
+// today's production and power curve and the output of every inverter
+// channel. The page uses the API of APIHandler, which must be served from
+// the same origin, and has no external dependencies
+func DashboardHandler() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err) // the embedded directory always exists
+	}
+	return http.FileServer(http.FS(files))
+}
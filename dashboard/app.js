@@ -0,0 +1,262 @@
+// Dashboard for aps serve. Loads the cached data from the JSON API and
+// follows /api/v1/stream for live updates; no external dependencies.
+"use strict";
+
+const api = "api/v1";
+const state = {
+  selected: "",
+  docs: {},     // latest snapshot per ECU ID
+  samples: {},  // today's power samples per ECU ID
+  events: [],
+  roof: {},     // whether a roof layout is configured, per ECU ID
+};
+
+const $ = (id) => document.getElementById(id);
+
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [k, v] of Object.entries(attrs || {})) {
+    if (k === "style") node.style.cssText = v;
+    else node.setAttribute(k, v);
+  }
+  for (const c of children) node.append(c);
+  return node;
+}
+
+function svg(tag, attrs) {
+  const node = document.createElementNS("http://www.w3.org/2000/svg", tag);
+  for (const [k, v] of Object.entries(attrs || {})) node.setAttribute(k, v);
+  return node;
+}
+
+async function getJSON(path) {
+  const resp = await fetch(`${api}/${path}`);
+  if (!resp.ok) throw new Error(`${path}: ${resp.status}`);
+  return resp.json();
+}
+
+// ECU timestamps carry the offset of the ECU time zone. Times are shown in
+// that zone, rather than the zone of the browser
+const clock = (ts) => ts.substring(11, 16);
+const minuteOfDay = (ts) => parseInt(ts.substring(11, 13), 10) * 60 + parseInt(ts.substring(14, 16), 10);
+
+function formatPower(w) {
+  return w >= 1000 ? `${(w / 1000).toFixed(2)} kW` : `${w} W`;
+}
+
+function formatEnergy(wh) {
+  return wh >= 1000000 ? `${(wh / 1000000).toFixed(2)} MWh` : `${(wh / 1000).toFixed(2)} kWh`;
+}
+
+// Channel colour from dark (no output) to bright yellow (best channel)
+function outputColour(ratio) {
+  const r = Math.max(0, Math.min(1, ratio));
+  return `hsl(${20 + 25 * r}, ${40 + 55 * r}%, ${18 + 42 * r}%)`;
+}
+
+// levelColour runs from red (0) to green (1)
+function levelColour(ratio) {
+  const r = Math.max(0, Math.min(1, ratio));
+  return `hsl(${120 * r}, 55%, 32%)`;
+}
+
+// cellStyle colours a channel cell by the metric selected for the grid
+function cellStyle(metric, inv, ch, best) {
+  switch (metric) {
+    case "temperature":
+      // 20 °C and cooler is green, 75 °C and hotter red
+      return `background: ${levelColour(1 - (inv.temperature_c - 20) / 55)}; color: #eee`;
+    case "signal":
+      if (inv.signal_pct === undefined) return "";
+      return `background: ${levelColour(inv.signal_pct / 100)}; color: #eee`;
+    default: {
+      const ratio = best ? ch.power_w / best : 0;
+      return `background: ${outputColour(ratio)}; color: ${ratio > 0.4 ? "#111" : "#ddd"}`;
+    }
+  }
+}
+
+function temperatureColour(c) {
+  if (c >= 70) return "var(--bad)";
+  if (c >= 55) return "var(--accent)";
+  return "inherit";
+}
+
+function render() {
+  const doc = state.docs[state.selected];
+  if (!doc) return;
+
+  $("power").textContent = formatPower(doc.ecu.power_w);
+  $("today").textContent = formatEnergy(doc.ecu.today_energy_wh);
+  $("lifetime").textContent = formatEnergy(doc.ecu.lifetime_energy_wh);
+  $("online").textContent = `${doc.ecu.inverters_online}/${doc.ecu.inverters_registered}`;
+  $("updated").textContent = clock(doc.timestamp) + (doc.stale ? " (stale)" : "");
+
+  renderRoof(doc);
+  renderInverters(doc);
+  renderChart(state.samples[state.selected] || []);
+  renderEvents();
+}
+
+function renderRoof(doc) {
+  const id = doc.ecu.ecu_id;
+  $("roof-section").hidden = !state.roof[id];
+  if (!state.roof[id]) return;
+  // The timestamp makes the browser reload the image when the ECU refreshes
+  const value = $("roof-value").value;
+  $("roof").src = `${api}/ecus/${id}/roof.svg?value=${value}&t=${encodeURIComponent(doc.timestamp)}`;
+}
+
+function renderInverters(doc) {
+  let best = 0;
+  for (const inv of doc.inverters) {
+    for (const ch of inv.channels) best = Math.max(best, ch.power_w);
+  }
+
+  const metric = $("inverter-colour").value;
+  const cards = doc.inverters.map((inv) => {
+    const channels = inv.channels.map((ch) => el("div", {
+      class: "channel",
+      style: cellStyle(metric, inv, ch, best),
+      title: `${inv.inverter_id} channel ${ch.channel}`,
+    }, `${ch.channel}: ${ch.power_w} W`));
+
+    const signal = inv.signal_pct === undefined ? "" : ` · signal ${Math.round(inv.signal_pct)}%`;
+    const meta = el("div", { class: "meta" },
+      `${inv.model} · ${inv.power_w} W · `,
+      el("span", { style: `color: ${temperatureColour(inv.temperature_c)}` }, `${inv.temperature_c} °C`),
+      signal);
+
+    return el("div", { class: inv.online ? "inverter" : "inverter offline" },
+      el("div", { class: "name" }, inv.inverter_id + (inv.online ? "" : " (offline)")),
+      meta,
+      el("div", { class: "channels" }, ...channels));
+  });
+  $("inverters").replaceChildren(...cards);
+}
+
+function renderChart(samples) {
+  const chart = $("chart");
+  const width = 800, height = 240, top = 10, bottom = 20;
+  const nodes = [];
+
+  // Daylight hours by default, extended when samples fall outside
+  let from = 6 * 60, to = 22 * 60, peak = 0;
+  for (const s of samples) {
+    const m = minuteOfDay(s.time);
+    from = Math.min(from, m);
+    to = Math.max(to, m);
+    peak = Math.max(peak, s.power_w);
+  }
+  peak = Math.max(100, Math.ceil(peak / 100) * 100);
+  const x = (m) => ((m - from) / (to - from)) * width;
+  const y = (w) => height - bottom - (w / peak) * (height - top - bottom);
+
+  for (let h = Math.ceil(from / 60); h * 60 <= to; h += 2) {
+    nodes.push(svg("line", { class: "grid", x1: x(h * 60), x2: x(h * 60), y1: top, y2: height - bottom }));
+    const label = svg("text", { x: x(h * 60) + 2, y: height - 5 });
+    label.textContent = `${String(h).padStart(2, "0")}:00`;
+    nodes.push(label);
+  }
+  for (const w of [peak / 2, peak]) {
+    nodes.push(svg("line", { class: "grid", x1: 0, x2: width, y1: y(w), y2: y(w) }));
+    const label = svg("text", { x: 4, y: y(w) + 12 });
+    label.textContent = formatPower(w);
+    nodes.push(label);
+  }
+
+  if (samples.length > 0) {
+    const points = samples.map((s) => `${x(minuteOfDay(s.time)).toFixed(1)},${y(s.power_w).toFixed(1)}`);
+    const first = x(minuteOfDay(samples[0].time)).toFixed(1);
+    const last = x(minuteOfDay(samples[samples.length - 1].time)).toFixed(1);
+    nodes.push(svg("polygon", { class: "area", points: `${first},${y(0)} ${points.join(" ")} ${last},${y(0)}` }));
+    nodes.push(svg("polyline", { class: "curve", points: points.join(" ") }));
+  }
+  chart.replaceChildren(...nodes);
+}
+
+function renderEvents() {
+  const items = state.events
+    .filter((e) => e.ecu_id === state.selected)
+    .slice(0, 20)
+    .map((e) => el("li", {},
+      el("span", { class: "time" }, e.time.substring(0, 19).replace("T", " ")),
+      `${e.inverter_id || e.ecu_id}: ${e.type.replace(/_/g, " ")}`));
+  $("events").replaceChildren(...items);
+}
+
+function addSnapshot(doc) {
+  const id = doc.ecu.ecu_id;
+  const samples = state.samples[id] || [];
+  const last = samples[samples.length - 1];
+  if (last && last.time.substring(0, 10) !== doc.timestamp.substring(0, 10)) {
+    samples.length = 0; // a new day
+  }
+  if (!last || last.time !== doc.timestamp) {
+    samples.push({ time: doc.timestamp, power_w: doc.ecu.power_w, today_energy_wh: doc.ecu.today_energy_wh });
+  }
+  state.samples[id] = samples;
+  state.docs[id] = doc;
+  updateSelect();
+}
+
+function updateSelect() {
+  const select = $("ecu");
+  const ids = Object.keys(state.docs).sort();
+  if (!state.selected) state.selected = ids[0] || "";
+  if (select.options.length !== ids.length) {
+    select.replaceChildren(...ids.map((id) => el("option", { value: id }, id)));
+    select.value = state.selected;
+  }
+  select.hidden = ids.length < 2;
+}
+
+function connect() {
+  const status = $("status");
+  const stream = new EventSource(`${api}/stream`);
+  stream.onopen = () => {
+    status.textContent = "live";
+    status.className = "status live";
+  };
+  stream.onerror = () => {
+    status.textContent = "reconnecting…";
+    status.className = "status down";
+  };
+  stream.addEventListener("snapshot", (e) => {
+    addSnapshot(JSON.parse(e.data));
+    render();
+  });
+  stream.addEventListener("event", (e) => {
+    state.events.unshift(JSON.parse(e.data));
+    state.events.length = Math.min(state.events.length, 200);
+    renderEvents();
+  });
+}
+
+async function load() {
+  const ecus = await getJSON("ecus");
+  for (const ecu of ecus) {
+    const [doc, energy, events, roof] = await Promise.all([
+      getJSON(`ecus/${ecu.ecu_id}`),
+      getJSON(`ecus/${ecu.ecu_id}/energy`),
+      getJSON(`ecus/${ecu.ecu_id}/events`),
+      fetch(`${api}/ecus/${ecu.ecu_id}/roof.svg`, { method: "HEAD" }),
+    ]);
+    state.roof[ecu.ecu_id] = roof.ok;
+    state.samples[ecu.ecu_id] = energy.samples;
+    state.events.push(...events);
+    addSnapshot(doc);
+  }
+  state.events.sort((a, b) => (a.time < b.time ? 1 : -1));
+  render();
+}
+
+$("roof-value").addEventListener("change", render);
+$("inverter-colour").addEventListener("change", render);
+
+$("ecu").addEventListener("change", (e) => {
+  state.selected = e.target.value;
+  render();
+});
+
+load().catch((err) => console.error(err)).finally(connect);
@@ -0,0 +1,50 @@
+package ecur
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboardHandler(t *testing.T) {
+	srv := httptest.NewServer(DashboardHandler())
+	defer srv.Close()
+
+	for path, contentType := range map[string]string{
+		"/":          "text/html",
+		"/app.js":    "javascript",
+		"/style.css": "text/css",
+	} {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, path)
+		require.Contains(t, resp.Header.Get("Content-Type"), contentType, path)
+	}
+}
+
+func TestDashboardSelfContained(t *testing.T) {
+	// The dashboard must work without internet access
+	err := fs.WalkDir(dashboardFiles, "dashboard", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := dashboardFiles.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.Contains(line, "http://") || strings.Contains(line, "https://") {
+				require.Contains(t, line, "http://www.w3.org/2000/svg", path)
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,176 @@
+package ecur
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DiscoverOptions configures Discover
+type DiscoverOptions struct {
+	Port        int
+	Timeout     time.Duration // per host, for connecting and the handshake
+	Concurrency int           // maximum number of hosts probed at the same time
+}
+
+func DefaultDiscoverOptions() DiscoverOptions {
+	return DiscoverOptions{
+		Port:        DefaultPort,
+		Timeout:     time.Second,
+		Concurrency: 64,
+	}
+}
+
+// DiscoveredECU is an ECU-R that answered the ECUInfo handshake
+type DiscoveredECU struct {
+	Address string
+	Port    int
+	ECUInfo ECUInfo
+}
+
+// maxDiscoverHosts limits the size of the networks that Discover scans
+const maxDiscoverHosts = 1 << 16
+
+// Discover scans the given networks for ECU-Rs. Every host that accepts a
+// connection on the port is confirmed with the ECUInfo handshake. Results
+// are sorted by address
+func Discover(ctx context.Context, networks []*net.IPNet, opts DiscoverOptions) ([]DiscoveredECU, error) {
+	var hosts []net.IP
+	for _, n := range networks {
+		h, err := networkHosts(n)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h...)
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	var (
+		mu    sync.Mutex
+		found []DiscoveredECU
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, opts.Concurrency)
+	)
+	for _, ip := range hosts {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return found, ctx.Err()
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			info, err := Probe(ctx, address, opts.Port, opts.Timeout)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			found = append(found, DiscoveredECU{Address: address, Port: opts.Port, ECUInfo: info})
+			mu.Unlock()
+		}(ip.String())
+	}
+	wg.Wait()
+
+	sort.Slice(found, func(i, j int) bool {
+		return binary.BigEndian.Uint32(net.ParseIP(found[i].Address).To4()) < binary.BigEndian.Uint32(net.ParseIP(found[j].Address).To4())
+	})
+	return found, nil
+}
+
+// Probe connects to a single host and performs the ECUInfo handshake
+func Probe(ctx context.Context, address string, port int, timeout time.Duration) (ECUInfo, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return ECUInfo{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := fmt.Fprint(conn, CmdECUInfo); err != nil {
+		return ECUInfo{}, err
+	}
+	raw, err := ApsRead(conn)
+	if err != nil {
+		return ECUInfo{}, err
+	}
+	return NewECUInfo(raw)
+}
+
+// LocalNetworks returns the IPv4 networks of the local, non-loopback interfaces
+func LocalNetworks() ([]*net.IPNet, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var networks []*net.IPNet
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			networks = append(networks, &net.IPNet{IP: ipNet.IP.Mask(ipNet.Mask), Mask: ipNet.Mask})
+		}
+	}
+	return networks, nil
+}
+
+// ScannableNetworks splits the networks into those that Discover can scan
+// and those that are too large, such as the /8 of a VPN
+func ScannableNetworks(networks []*net.IPNet) (scannable, tooLarge []*net.IPNet) {
+	for _, n := range networks {
+		ones, bits := n.Mask.Size()
+		if bits-ones > 30 || 1<<uint(bits-ones) > maxDiscoverHosts {
+			tooLarge = append(tooLarge, n)
+			continue
+		}
+		scannable = append(scannable, n)
+	}
+	return scannable, tooLarge
+}
+
+// networkHosts lists the host addresses of an IPv4 network, excluding the
+// network and broadcast addresses for networks larger than /31
+func networkHosts(n *net.IPNet) ([]net.IP, error) {
+	ip := n.IP.To4()
+	if ip == nil {
+		return nil, fmt.Errorf("network %s is not an IPv4 network", n)
+	}
+	ones, bits := n.Mask.Size()
+	size := 1 << uint(bits-ones)
+	if size > maxDiscoverHosts {
+		return nil, fmt.Errorf("network %s is too large to scan (more than %d addresses)", n, maxDiscoverHosts)
+	}
+
+	start := binary.BigEndian.Uint32(ip.Mask(n.Mask))
+	first, last := 0, size
+	if size > 2 {
+		first, last = 1, size-1
+	}
+	var hosts []net.IP
+	for i := first; i < last; i++ {
+		host := make(net.IP, 4)
+		binary.BigEndian.PutUint32(host, start+uint32(i))
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
@@ -0,0 +1,76 @@
+package ecur
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testECUInfoRaw is an ECUInfo response of ECU 216000011111
+var testECUInfoRaw = []byte{65, 80, 83, 49, 49, 48, 48, 57, 52, 48, 48, 48, 49, 50, 49, 54, 48, 48, 48, 48, 49, 49, 49, 49, 49, 48, 49, 0, 0, 166, 243, 0, 0, 1, 36, 0, 0, 0, 69, 208, 208, 208, 208, 208, 208, 208, 0, 2, 0, 2, 49, 48, 48, 49, 50, 69, 67, 85, 95, 82, 95, 49, 46, 50, 46, 49, 57, 48, 48, 57, 69, 116, 99, 47, 71, 77, 84, 45, 56, 128, 151, 27, 1, 164, 227, 0, 0, 0, 0, 0, 0, 69, 78, 68, 10}
+
+// fakeECU answers ECUInfo requests on a local port
+func fakeECU(t *testing.T, address string) int {
+	l, err := net.Listen("tcp", address+":0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err == nil && line == CmdECUInfo {
+					conn.Write(testECUInfoRaw)
+				}
+			}(conn)
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestDiscover(t *testing.T) {
+	port := fakeECU(t, "127.0.0.1")
+
+	_, network, err := net.ParseCIDR("127.0.0.0/30")
+	require.NoError(t, err)
+	opts := DefaultDiscoverOptions()
+	opts.Port = port
+	opts.Timeout = 500 * time.Millisecond
+
+	found, err := Discover(context.Background(), []*net.IPNet{network}, opts)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "127.0.0.1", found[0].Address)
+	require.Equal(t, "216000011111", found[0].ECUInfo.EcuID)
+	require.Equal(t, "ECU_R_1.2.19", found[0].ECUInfo.Version)
+}
+
+func TestNetworkHosts(t *testing.T) {
+	_, network, _ := net.ParseCIDR("192.168.1.0/24")
+	hosts, err := networkHosts(network)
+	require.NoError(t, err)
+	require.Len(t, hosts, 254)
+	require.Equal(t, "192.168.1.1", hosts[0].String())
+	require.Equal(t, "192.168.1.254", hosts[253].String())
+
+	_, network, _ = net.ParseCIDR("10.0.0.0/8")
+	_, err = networkHosts(network)
+	require.Error(t, err)
+}
+
+func TestScannableNetworks(t *testing.T) {
+	_, home, _ := net.ParseCIDR("192.168.1.0/24")
+	_, vpn, _ := net.ParseCIDR("10.0.0.0/8")
+	scannable, tooLarge := ScannableNetworks([]*net.IPNet{vpn, home})
+	require.Equal(t, []*net.IPNet{home}, scannable)
+	require.Equal(t, []*net.IPNet{vpn}, tooLarge)
+}
@@ -9,4 +9,6 @@ var (
 	ErrNotConnected        = errors.New("not connected to ECU-R")
 	ErrMalformedBody       = errors.New("binary body not as expected")
 	ErrUnknownInverterType = errors.New("unknown inverter type")
+	ErrECUIDMismatch       = errors.New("ECU-R ID does not match the expected ID")
+	ErrInvalidRule         = errors.New("invalid alert rule")
 )
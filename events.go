@@ -0,0 +1,93 @@
+package ecur
+
+import (
+	"fmt"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventInverterOffline         EventType = "inverter_offline"
+	EventInverterOnline          EventType = "inverter_online"
+	EventInverterAdded           EventType = "inverter_added"
+	EventInverterRemoved         EventType = "inverter_removed"
+	EventVersionChanged          EventType = "version_changed"
+	EventTimestampStalled        EventType = "timestamp_stalled"
+	EventTodayEnergyReset        EventType = "today_energy_reset"
+	EventLifetimeEnergyDecreased EventType = "lifetime_energy_decreased"
+)
+
+// Event describes a single change between two consecutive snapshots. Before
+// and After hold the compared values; their type depends on the event type
+type Event struct {
+	Type       EventType
+	Time       time.Time // collection time of the newer snapshot
+	EcuID      string
+	InverterID string `json:",omitempty"`
+	Before     interface{}
+	After      interface{}
+}
+
+func (e Event) String() string {
+	subject := e.EcuID
+	if e.InverterID != "" {
+		subject = fmt.Sprintf("%s/%s", e.EcuID, e.InverterID)
+	}
+	return fmt.Sprintf("%s %s %s: %v -> %v", e.Time.Format("2006-01-02 15:04:05"), subject, e.Type, e.Before, e.After)
+}
+
+// Diff compares two consecutive snapshots and returns the events that
+// happened in between. Events are returned in a stable order: ECU level
+// events first, followed by inverter events in the order of the newer snapshot
+func Diff(prev, next Snapshot) []Event {
+	var events []Event
+	add := func(t EventType, inverterID string, before, after interface{}) {
+		events = append(events, Event{
+			Type:       t,
+			Time:       next.CollectedAt,
+			EcuID:      next.ECUInfo.EcuID,
+			InverterID: inverterID,
+			Before:     before,
+			After:      after,
+		})
+	}
+
+	// ECU level
+	if prev.ECUInfo.Version != next.ECUInfo.Version {
+		add(EventVersionChanged, "", prev.ECUInfo.Version, next.ECUInfo.Version)
+	}
+	// Once, when the snapshot becomes stale (see Collector.StaleAfter): the
+	// ECU-R only refreshes every 5 minutes, so equal timestamps are normal
+	if next.Stale && !prev.Stale {
+		add(EventTimestampStalled, "", prev.ArrayInfo.Timestamp, next.ArrayInfo.Timestamp)
+	}
+	if next.ECUInfo.TodayEnergy < prev.ECUInfo.TodayEnergy {
+		add(EventTodayEnergyReset, "", prev.ECUInfo.TodayEnergy, next.ECUInfo.TodayEnergy)
+	}
+	if next.ECUInfo.LifetimeEnergy < prev.ECUInfo.LifetimeEnergy {
+		add(EventLifetimeEnergyDecreased, "", prev.ECUInfo.LifetimeEnergy, next.ECUInfo.LifetimeEnergy)
+	}
+
+	// Inverter level
+	for _, inv := range next.ArrayInfo.Inverters {
+		old, ok := prev.Inverter(inv.ID)
+		if !ok {
+			add(EventInverterAdded, inv.ID, nil, inv.Model)
+			continue
+		}
+		if old.Online && !inv.Online {
+			add(EventInverterOffline, inv.ID, true, false)
+		}
+		if !old.Online && inv.Online {
+			add(EventInverterOnline, inv.ID, false, true)
+		}
+	}
+	for _, inv := range prev.ArrayInfo.Inverters {
+		if _, ok := next.Inverter(inv.ID); !ok {
+			add(EventInverterRemoved, inv.ID, inv.Model, nil)
+		}
+	}
+
+	return events
+}
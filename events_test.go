@@ -0,0 +1,88 @@
+package ecur
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testSnapshot(collected time.Time) Snapshot {
+	return Snapshot{
+		ECUResponse: ECUResponse{
+			ECUInfo: ECUInfo{
+				EcuID:          "216000011111",
+				Version:        "ECU_R_1.2.18",
+				LifetimeEnergy: 4265500,
+				TodayEnergy:    3960,
+			},
+			ArrayInfo: ArrayInfo{
+				Timestamp: time.Date(2021, 10, 28, 10, 0, 0, 0, time.UTC),
+				Inverters: []InverterInfo{
+					{ID: "801000030000", Online: true, Model: "QS1"},
+					{ID: "801000030001", Online: true, Model: "QS1"},
+				},
+			},
+		},
+		CollectedAt: collected,
+	}
+}
+
+func TestDiffNoChanges(t *testing.T) {
+	prev := testSnapshot(time.Now())
+	next := testSnapshot(time.Now())
+	next.ArrayInfo.Timestamp = prev.ArrayInfo.Timestamp.Add(5 * time.Minute)
+	require.Empty(t, Diff(prev, next))
+}
+
+func TestDiffECUEvents(t *testing.T) {
+	prev := testSnapshot(time.Now())
+	next := testSnapshot(time.Now())
+	next.ECUInfo.Version = "ECU_R_1.2.19"
+	next.ECUInfo.TodayEnergy = 0
+	next.ECUInfo.LifetimeEnergy = 100
+
+	next.Stale = true
+
+	events := Diff(prev, next)
+	require.Len(t, events, 4)
+	require.Equal(t, EventVersionChanged, events[0].Type)
+	require.Equal(t, "ECU_R_1.2.18", events[0].Before)
+	require.Equal(t, "ECU_R_1.2.19", events[0].After)
+	require.Equal(t, EventTimestampStalled, events[1].Type)
+	require.Equal(t, EventTodayEnergyReset, events[2].Type)
+	require.Equal(t, 3960, events[2].Before)
+	require.Equal(t, 0, events[2].After)
+	require.Equal(t, EventLifetimeEnergyDecreased, events[3].Type)
+}
+
+func TestDiffTimestampStalled(t *testing.T) {
+	prev := testSnapshot(time.Now())
+	next := testSnapshot(time.Now())
+
+	// An unchanged timestamp is normal until the snapshot becomes stale
+	require.Empty(t, Diff(prev, next))
+	next.Stale = true
+	require.Len(t, Diff(prev, next), 1)
+	prev.Stale = true
+	require.Empty(t, Diff(prev, next))
+}
+
+func TestDiffInverterEvents(t *testing.T) {
+	prev := testSnapshot(time.Now())
+	prev.ArrayInfo.Inverters[1].Online = false
+	next := testSnapshot(time.Now())
+	next.ArrayInfo.Timestamp = prev.ArrayInfo.Timestamp.Add(5 * time.Minute)
+	next.ArrayInfo.Inverters[0].Online = false
+	next.ArrayInfo.Inverters = append(next.ArrayInfo.Inverters, InverterInfo{ID: "801000030002", Model: "QS1"})
+
+	events := Diff(prev, next)
+	require.Len(t, events, 3)
+	require.Equal(t, EventInverterOffline, events[0].Type)
+	require.Equal(t, "801000030000", events[0].InverterID)
+	require.Equal(t, EventInverterOnline, events[1].Type)
+	require.Equal(t, "801000030001", events[1].InverterID)
+	require.Equal(t, EventInverterAdded, events[2].Type)
+	require.Equal(t, "801000030002", events[2].InverterID)
+	require.Equal(t, next.CollectedAt, events[2].Time)
+}
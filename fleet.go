@@ -0,0 +1,118 @@
+package ecur
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultFleetConcurrency is the number of sites a Fleet polls at the same time
+const DefaultFleetConcurrency = 4
+
+// Site is a named installation with its own ECU-R
+type Site struct {
+	Name   string
+	Source DataSource
+}
+
+// Fleet polls the ECU-Rs of several sites concurrently
+type Fleet struct {
+	sites       []Site
+	concurrency int
+	now         func() time.Time
+}
+
+func NewFleet(concurrency int, sites ...Site) *Fleet {
+	if concurrency < 1 {
+		concurrency = DefaultFleetConcurrency
+	}
+	return &Fleet{
+		sites:       sites,
+		concurrency: concurrency,
+		now:         time.Now,
+	}
+}
+
+// SiteResult is the outcome of polling a single site
+type SiteResult struct {
+	Name     string
+	Snapshot Snapshot
+	Err      error
+}
+
+// FleetTotals sums the ECU level figures of all sites that were polled successfully
+type FleetTotals struct {
+	Sites               int
+	SitesFailed         int
+	Power               int // in W
+	TodayEnergy         int // in Wh
+	LifetimeEnergy      int // in Wh
+	InvertersOnline     int
+	InvertersRegistered int
+}
+
+// FleetResult holds the results per site, in the order the sites were added,
+// and the fleet totals
+type FleetResult struct {
+	Sites  []SiteResult
+	Totals FleetTotals
+}
+
+// Poll reads all sites, at most Concurrency at the same time. A failing site
+// does not affect the others. Sites that have not answered when the context
+// is done are reported with the context error
+func (f *Fleet) Poll(ctx context.Context) FleetResult {
+	type indexed struct {
+		i   int
+		res SiteResult
+	}
+
+	results := make([]SiteResult, len(f.sites))
+	done := make([]bool, len(f.sites))
+	ch := make(chan indexed, len(f.sites))
+	sem := make(chan struct{}, f.concurrency)
+
+	go func() {
+		for i, site := range f.sites {
+			select {
+			case <-ctx.Done():
+				return
+			case sem <- struct{}{}:
+			}
+			go func(i int, site Site) {
+				defer func() { <-sem }()
+				resp, err := site.Source.GetData()
+				ch <- indexed{i, SiteResult{Name: site.Name, Snapshot: NewSnapshot(resp, f.now()), Err: err}}
+			}(i, site)
+		}
+	}()
+
+	for received := 0; received < len(f.sites); received++ {
+		select {
+		case r := <-ch:
+			results[r.i], done[r.i] = r.res, true
+		case <-ctx.Done():
+			received = len(f.sites)
+		}
+	}
+	for i, site := range f.sites {
+		if !done[i] {
+			results[i] = SiteResult{Name: site.Name, Err: ctx.Err()}
+		}
+	}
+
+	res := FleetResult{Sites: results}
+	for _, r := range results {
+		res.Totals.Sites++
+		if r.Err != nil {
+			res.Totals.SitesFailed++
+			continue
+		}
+		info := r.Snapshot.ECUInfo
+		res.Totals.Power += info.LastPower
+		res.Totals.TodayEnergy += info.TodayEnergy
+		res.Totals.LifetimeEnergy += info.LifetimeEnergy
+		res.Totals.InvertersOnline += info.InvertersOnline
+		res.Totals.InvertersRegistered += info.InvertersRegistered
+	}
+	return res
+}
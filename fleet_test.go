@@ -0,0 +1,66 @@
+package ecur
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockingSource never answers until released
+type blockingSource struct {
+	release chan struct{}
+}
+
+func (b *blockingSource) GetData() (ECUResponse, error) {
+	<-b.release
+	return ECUResponse{}, nil
+}
+
+func TestFleetPoll(t *testing.T) {
+	resp := testSnapshot(time.Now()).ECUResponse
+	resp.ECUInfo.LastPower = 300
+	resp.ECUInfo.InvertersOnline = 2
+	resp.ECUInfo.InvertersRegistered = 2
+
+	fleet := NewFleet(2,
+		Site{Name: "home", Source: &fakeSource{responses: []ECUResponse{resp}}},
+		Site{Name: "cabin", Source: &fakeSource{err: errors.New("unreachable")}},
+		Site{Name: "office", Source: &fakeSource{responses: []ECUResponse{resp}}},
+	)
+	res := fleet.Poll(context.Background())
+
+	require.Len(t, res.Sites, 3)
+	require.Equal(t, "home", res.Sites[0].Name)
+	require.NoError(t, res.Sites[0].Err)
+	require.Equal(t, "cabin", res.Sites[1].Name)
+	require.Error(t, res.Sites[1].Err)
+	require.Equal(t, FleetTotals{
+		Sites:               3,
+		SitesFailed:         1,
+		Power:               600,
+		TodayEnergy:         2 * 3960,
+		LifetimeEnergy:      2 * 4265500,
+		InvertersOnline:     4,
+		InvertersRegistered: 4,
+	}, res.Totals)
+}
+
+func TestFleetPollTimeout(t *testing.T) {
+	hanging := &blockingSource{release: make(chan struct{})}
+	defer close(hanging.release)
+
+	fleet := NewFleet(1,
+		Site{Name: "home", Source: &fakeSource{responses: []ECUResponse{testSnapshot(time.Now()).ECUResponse}}},
+		Site{Name: "hanging", Source: hanging},
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	res := fleet.Poll(ctx)
+	require.NoError(t, res.Sites[0].Err)
+	require.ErrorIs(t, res.Sites[1].Err, context.DeadlineExceeded)
+	require.Equal(t, 1, res.Totals.SitesFailed)
+}
@@ -0,0 +1,99 @@
+package ecur
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultGapThreshold is the shortest interval without stored snapshots that
+// counts as a gap. The ECU-R refreshes every 5 minutes
+const DefaultGapThreshold = 15 * time.Minute
+
+// Gap is an interval without stored snapshots, between the ECU timestamps
+// of the last snapshot before and the first snapshot after it
+type Gap struct {
+	EcuID string    `json:"ecu_id"`
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+}
+
+func (g Gap) Duration() time.Duration {
+	return g.To.Sub(g.From)
+}
+
+func (g Gap) String() string {
+	return fmt.Sprintf("%s %s - %s (%s)", g.EcuID, g.From.Format("2006-01-02 15:04"), g.To.Format("2006-01-02 15:04"), g.Duration())
+}
+
+// Gaps returns the intervals of more than threshold without stored snapshots
+// of the ECU-R, within [from, to). A zero threshold uses DefaultGapThreshold
+func (st *Store) Gaps(ecuID string, from, to time.Time, threshold time.Duration) ([]Gap, error) {
+	snapshots, err := st.Snapshots(ecuID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var gaps []Gap
+	for i := 1; i < len(snapshots); i++ {
+		if isGap(snapshots[i-1], snapshots[i], threshold) {
+			gaps = append(gaps, Gap{EcuID: ecuID, From: snapshots[i-1].ArrayInfo.Timestamp, To: snapshots[i].ArrayInfo.Timestamp})
+		}
+	}
+	return gaps, nil
+}
+
+// isGap reports whether the interval between two consecutive snapshots is a
+// gap. A night, without production on either side and without the noon of a
+// day in between, is not
+func isGap(prev, next Snapshot, threshold time.Duration) bool {
+	if threshold <= 0 {
+		threshold = DefaultGapThreshold
+	}
+	from, to := prev.ArrayInfo.Timestamp, next.ArrayInfo.Timestamp
+	if to.Sub(from) <= threshold {
+		return false
+	}
+	if prev.ECUInfo.LastPower == 0 && next.ECUInfo.LastPower == 0 {
+		noon := time.Date(from.Year(), from.Month(), from.Day(), 12, 0, 0, 0, from.Location())
+		if !noon.After(from) {
+			noon = noon.AddDate(0, 0, 1)
+		}
+		return noon.Before(to)
+	}
+	return true
+}
+
+// lastStored returns the stored snapshot of the ECU-R with the latest ECU
+// timestamp before ts. The caller holds the lock
+func (st *Store) lastStored(ecuID string, ts time.Time) (Snapshot, bool, error) {
+	days, err := st.segmentDays(ecuID)
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+
+	dir := filepath.Join(st.dir, ecuID, storeRawDir)
+	for i := len(days) - 1; i >= 0; i-- {
+		var last Snapshot
+		found := false
+		for _, ext := range []string{compactedExt, segmentExt} {
+			segment, err := readSegment(filepath.Join(dir, days[i]+ext))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return Snapshot{}, false, err
+			}
+			for _, s := range segment {
+				if s.ArrayInfo.Timestamp.Before(ts) && (!found || s.ArrayInfo.Timestamp.After(last.ArrayInfo.Timestamp)) {
+					last, found = s, true
+				}
+			}
+		}
+		if found {
+			return last, true, nil
+		}
+	}
+	return Snapshot{}, false, nil
+}
@@ -0,0 +1,95 @@
+package ecur
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gapSnapshot returns a snapshot with the given ECU timestamp and ECU power
+func gapSnapshot(ts time.Time, power int) Snapshot {
+	s := storeSnapshot(ts, power)
+	s.ECUInfo.LastPower = power
+	return s
+}
+
+func TestStoreGaps(t *testing.T) {
+	st, err := OpenStore(t.TempDir())
+	require.NoError(t, err)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time {
+		return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute)
+	}
+	for _, s := range []Snapshot{
+		gapSnapshot(at(9, 0), 100),
+		gapSnapshot(at(9, 5), 100),
+		gapSnapshot(at(10, 5), 100), // an hour of downtime
+		gapSnapshot(at(10, 10), 100),
+		gapSnapshot(at(21, 0), 0),
+		gapSnapshot(at(30, 0), 0), // the night is not a gap
+		gapSnapshot(at(30, 5), 0),
+		gapSnapshot(at(55, 0), 0), // a day without readings is
+	} {
+		require.NoError(t, st.Write(s))
+	}
+
+	gaps, err := st.Gaps("216000011111", time.Time{}, time.Time{}, 0)
+	require.NoError(t, err)
+	require.Len(t, gaps, 3)
+	require.Equal(t, time.Hour, gaps[0].Duration())
+	require.Equal(t, at(10, 10), gaps[1].From)
+	require.Equal(t, at(21, 0), gaps[1].To)
+	require.Equal(t, at(30, 5), gaps[2].From)
+	require.Equal(t, 24*time.Hour+55*time.Minute, gaps[2].Duration())
+
+	gaps, err = st.Gaps("216000011111", time.Time{}, time.Time{}, 2*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, gaps, 2)
+}
+
+func TestIsGapNight(t *testing.T) {
+	evening := time.Date(2021, 6, 1, 21, 0, 0, 0, time.UTC)
+	night := func(d time.Duration) bool {
+		return isGap(gapSnapshot(evening, 0), gapSnapshot(evening.Add(d), 0), 0)
+	}
+	require.False(t, night(9*time.Hour))
+	require.True(t, night(25*time.Hour))
+	require.True(t, isGap(gapSnapshot(evening, 0), gapSnapshot(evening.Add(9*time.Hour), 50), 0))
+}
+
+func TestStoreOnGap(t *testing.T) {
+	dir := t.TempDir()
+	st, err := OpenStore(dir)
+	require.NoError(t, err)
+
+	day := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, st.Write(gapSnapshot(day, 100)))
+	require.NoError(t, st.Write(gapSnapshot(day.Add(5*time.Minute), 100)))
+
+	// Restarted two hours later
+	st, err = OpenStore(dir)
+	require.NoError(t, err)
+	var gaps []Gap
+	st.OnGap = func(g Gap) { gaps = append(gaps, g) }
+	require.NoError(t, st.Write(gapSnapshot(day.Add(2*time.Hour), 100)))
+	require.NoError(t, st.Write(gapSnapshot(day.Add(3*time.Hour), 100)))
+	require.Equal(t, []Gap{{EcuID: "216000011111", From: day.Add(5 * time.Minute), To: day.Add(2 * time.Hour)}}, normalizeGaps(gaps))
+
+	// No gap after a quick restart
+	st, err = OpenStore(dir)
+	require.NoError(t, err)
+	gaps = nil
+	st.OnGap = func(g Gap) { gaps = append(gaps, g) }
+	require.NoError(t, st.Write(gapSnapshot(day.Add(3*time.Hour+5*time.Minute), 100)))
+	require.Empty(t, gaps)
+}
+
+// normalizeGaps converts the times to UTC, as read back from the store
+func normalizeGaps(gaps []Gap) []Gap {
+	for i := range gaps {
+		gaps[i].From, gaps[i].To = gaps[i].From.UTC(), gaps[i].To.UTC()
+	}
+	return gaps
+}
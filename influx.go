@@ -0,0 +1,177 @@
+package ecur
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultInfluxPrecision = "s"
+	DefaultInfluxBatchSize = 1
+	// DefaultInfluxMaxBuffered is the number of snapshots kept while
+	// InfluxDB can not be reached
+	DefaultInfluxMaxBuffered = 1000
+)
+
+var tagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// WriteLineProtocol writes the snapshot in InfluxDB line protocol. Points are
+// timestamped with the ECU timestamp, so that repeated polls of the same ECU
+// data overwrite each other. Precision is one of ns, us, ms or s
+func WriteLineProtocol(w io.Writer, s Snapshot, precision string) error {
+	ts, err := influxTimestamp(s.ArrayInfo.Timestamp, precision)
+	if err != nil {
+		return err
+	}
+
+	ecu := "ecu_id=" + tagEscaper.Replace(s.ECUInfo.EcuID)
+	fmt.Fprintf(w, "aps_ecu,%s power=%di,energy_today=%di,energy_lifetime=%di,inverters_online=%di,inverters_registered=%di %d\n",
+		ecu, s.ECUInfo.LastPower, s.ECUInfo.TodayEnergy, s.ECUInfo.LifetimeEnergy,
+		s.ECUInfo.InvertersOnline, s.ECUInfo.InvertersRegistered, ts)
+
+	for _, inv := range s.ArrayInfo.Inverters {
+		tags := fmt.Sprintf("%s,inverter_id=%s,model=%s", ecu, tagEscaper.Replace(inv.ID), tagEscaper.Replace(inv.Model))
+		fields := fmt.Sprintf("online=%t,frequency=%g,temperature=%di,voltage=%di", inv.Online, inv.Frequency, inv.Temperature, inv.VoltageA)
+		if signal, ok := s.Signal(inv.ID); ok {
+			fields += fmt.Sprintf(",signal=%di", signal)
+		}
+		fmt.Fprintf(w, "aps_inverter,%s %s %d\n", tags, fields, ts)
+
+		for _, ch := range inv.Channels() {
+			fmt.Fprintf(w, "aps_channel,%s,channel=%s power=%di %d\n", tags, ch.Name, ch.Power, ts)
+		}
+	}
+	return nil
+}
+
+func influxTimestamp(t time.Time, precision string) (int64, error) {
+	switch precision {
+	case "ns":
+		return t.UnixNano(), nil
+	case "us":
+		return t.UnixNano() / int64(time.Microsecond), nil
+	case "ms":
+		return t.UnixNano() / int64(time.Millisecond), nil
+	case "s":
+		return t.Unix(), nil
+	}
+	return 0, fmt.Errorf("unknown precision %q (use ns, us, ms or s)", precision)
+}
+
+// InfluxOptions configures an InfluxSink for the InfluxDB v2 write API
+type InfluxOptions struct {
+	URL       string // e.g. http://localhost:8086
+	Org       string
+	Bucket    string
+	Token     string
+	Precision string // ns, us, ms or s
+	// BatchSize is the number of snapshots buffered before they are written
+	BatchSize int
+	// MaxBuffered is the number of snapshots kept while writes fail. The
+	// oldest snapshots are dropped beyond it
+	MaxBuffered int
+	Client      *http.Client
+}
+
+// InfluxSink writes snapshots to the InfluxDB v2 write API in batches. It
+// implements Sink. Snapshots that fail to be written are kept and retried
+// with the next batch, up to MaxBuffered snapshots
+type InfluxSink struct {
+	opts InfluxOptions
+
+	mu      sync.Mutex
+	pending [][]byte // line protocol per snapshot
+	dropped int
+}
+
+func NewInfluxSink(opts InfluxOptions) *InfluxSink {
+	if opts.Precision == "" {
+		opts.Precision = DefaultInfluxPrecision
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultInfluxBatchSize
+	}
+	if opts.MaxBuffered < 1 {
+		opts.MaxBuffered = DefaultInfluxMaxBuffered
+	}
+	if opts.MaxBuffered < opts.BatchSize {
+		opts.MaxBuffered = opts.BatchSize
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &InfluxSink{opts: opts}
+}
+
+// Write buffers the snapshot and writes the batch once it is full. When the
+// buffer is full, the oldest snapshot is dropped; the number of dropped
+// snapshots is reported with the next failed write
+func (s *InfluxSink) Write(snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := WriteLineProtocol(&buf, snapshot, s.opts.Precision); err != nil {
+		return err
+	}
+	s.pending = append(s.pending, buf.Bytes())
+	if n := len(s.pending) - s.opts.MaxBuffered; n > 0 {
+		s.pending = append(s.pending[:0:0], s.pending[n:]...)
+		s.dropped += n
+	}
+	if len(s.pending) < s.opts.BatchSize {
+		return nil
+	}
+
+	err := s.flush()
+	if err != nil && s.dropped > 0 {
+		err = fmt.Errorf("%w (dropped %d oldest snapshots)", err, s.dropped)
+		s.dropped = 0
+	}
+	return err
+}
+
+// Flush writes all buffered snapshots
+func (s *InfluxSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flush()
+}
+
+func (s *InfluxSink) flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	query := url.Values{}
+	query.Set("org", s.opts.Org)
+	query.Set("bucket", s.opts.Bucket)
+	query.Set("precision", s.opts.Precision)
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.opts.URL, "/")+"/api/v2/write?"+query.Encode(), bytes.NewReader(bytes.Join(s.pending, nil)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.opts.Token)
+	}
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not write to InfluxDB: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("InfluxDB write failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	s.pending = nil
+	return nil
+}
@@ -0,0 +1,96 @@
+package ecur
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLineProtocol(t *testing.T) {
+	s := testSnapshot(time.Now())
+	s.ECUInfo.LastPower = 292
+	s.ArrayInfo.Inverters = s.ArrayInfo.Inverters[:1]
+	s.ArrayInfo.Inverters[0].Frequency = 50.1
+	s.ArrayInfo.Inverters[0].PowerA = 57
+	s.InverterSignalInfo.Inverters = []InverterSignal{{ID: "801000030000", Signal: 213}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteLineProtocol(&buf, s, "s"))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 6)
+	require.Equal(t, "aps_ecu,ecu_id=216000011111 power=292i,energy_today=3960i,energy_lifetime=4265500i,inverters_online=0i,inverters_registered=0i 1635415200", lines[0])
+	require.Equal(t, "aps_inverter,ecu_id=216000011111,inverter_id=801000030000,model=QS1 online=true,frequency=50.1,temperature=0i,voltage=0i,signal=213i 1635415200", lines[1])
+	require.Equal(t, "aps_channel,ecu_id=216000011111,inverter_id=801000030000,model=QS1,channel=A power=57i 1635415200", lines[2])
+
+	buf.Reset()
+	require.NoError(t, WriteLineProtocol(&buf, s, "ms"))
+	require.Contains(t, buf.String(), " 1635415200000\n")
+
+	require.Error(t, WriteLineProtocol(&buf, s, "h"))
+}
+
+func TestInfluxSink(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewInfluxSink(InfluxOptions{URL: server.URL, Org: "home", Bucket: "solar", Token: "secret", BatchSize: 2})
+	s := testSnapshot(time.Now())
+
+	// First snapshot is buffered
+	require.NoError(t, sink.Write(s))
+	require.Empty(t, requests)
+
+	// Failed batch is retried
+	status = http.StatusInternalServerError
+	require.Error(t, sink.Write(s))
+	status = http.StatusNoContent
+	require.NoError(t, sink.Flush())
+	require.Len(t, requests, 2)
+	require.Equal(t, bodies[0], bodies[1])
+	require.Equal(t, 2, strings.Count(bodies[1], "aps_ecu,"))
+
+	r := requests[1]
+	require.Equal(t, "/api/v2/write", r.URL.Path)
+	require.Equal(t, "home", r.URL.Query().Get("org"))
+	require.Equal(t, "solar", r.URL.Query().Get("bucket"))
+	require.Equal(t, "s", r.URL.Query().Get("precision"))
+	require.Equal(t, "Token secret", r.Header.Get("Authorization"))
+
+	// Nothing left to flush
+	require.NoError(t, sink.Flush())
+	require.Len(t, requests, 2)
+}
+
+func TestInfluxSinkMaxBuffered(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink := NewInfluxSink(InfluxOptions{URL: server.URL, MaxBuffered: 3})
+	s := testSnapshot(time.Now())
+	for i := 0; i < 3; i++ {
+		require.Error(t, sink.Write(s))
+	}
+	err := sink.Write(s)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "dropped 1 oldest snapshots")
+	require.Equal(t, 3, strings.Count(bodies[len(bodies)-1], "aps_ecu,"))
+}
@@ -0,0 +1,198 @@
+package ecur
+
+import (
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// JSONSchemaVersion is the version of the JSON representation produced by
+// NewJSONDocument. It is increased for every incompatible change; fields may
+// be added without changing the version
+const JSONSchemaVersion = 1
+
+// JSONSchema is the JSON Schema describing JSONDocument
+//
+//go:embed schema/snapshot-v1.schema.json
+var JSONSchema []byte
+
+// JSONDocument is the stable, versioned JSON representation of a snapshot.
+// Field names are snake_case and carry their unit as a suffix
+type JSONDocument struct {
+	SchemaVersion int            `json:"schema_version"`
+	CollectedAt   time.Time      `json:"collected_at"`
+	Timestamp     time.Time      `json:"timestamp"`
+	ClockOffsetS  float64        `json:"clock_offset_s"`
+	Stale         bool           `json:"stale"`
+	ECU           JSONECU        `json:"ecu"`
+	Inverters     []JSONInverter `json:"inverters"`
+	Raw           *JSONRaw       `json:"raw,omitempty"`
+}
+
+type JSONECU struct {
+	EcuID               string `json:"ecu_id"`
+	FirmwareVersion     string `json:"firmware_version"`
+	InvertersRegistered int    `json:"inverters_registered"`
+	InvertersOnline     int    `json:"inverters_online"`
+	EthernetMac         string `json:"ethernet_mac"`
+	WirelessMac         string `json:"wireless_mac"`
+	PowerW              int    `json:"power_w"`
+	TodayEnergyWh       int    `json:"today_energy_wh"`
+	LifetimeEnergyWh    int    `json:"lifetime_energy_wh"`
+}
+
+type JSONInverter struct {
+	InverterID   string        `json:"inverter_id"`
+	Model        string        `json:"model"`
+	Online       bool          `json:"online"`
+	FrequencyHz  float64       `json:"frequency_hz"`
+	VoltageV     int           `json:"voltage_v"`
+	TemperatureC int           `json:"temperature_c"`
+	SignalRaw    *int          `json:"signal_raw,omitempty"` // 0-255
+	SignalPct    *float64      `json:"signal_pct,omitempty"`
+	PowerW       int           `json:"power_w"`
+	Channels     []JSONChannel `json:"channels"`
+}
+
+type JSONChannel struct {
+	Channel string `json:"channel"`
+	PowerW  int    `json:"power_w"`
+}
+
+// JSONRaw holds the raw ECU-R responses, hex encoded
+type JSONRaw struct {
+	ECUInfo            string `json:"ecu_info"`
+	ArrayInfo          string `json:"array_info"`
+	InverterSignalInfo string `json:"inverter_signal_info"`
+}
+
+// NewJSONDocument converts a snapshot into its JSON representation. The raw
+// ECU-R responses are only included when includeRaw is set
+func NewJSONDocument(s Snapshot, includeRaw bool) JSONDocument {
+	doc := JSONDocument{
+		SchemaVersion: JSONSchemaVersion,
+		CollectedAt:   s.CollectedAt,
+		Timestamp:     s.ArrayInfo.Timestamp,
+		ClockOffsetS:  s.ClockOffset.Seconds(),
+		Stale:         s.Stale,
+		ECU: JSONECU{
+			EcuID:               s.ECUInfo.EcuID,
+			FirmwareVersion:     s.ECUInfo.Version,
+			InvertersRegistered: s.ECUInfo.InvertersRegistered,
+			InvertersOnline:     s.ECUInfo.InvertersOnline,
+			EthernetMac:         s.ECUInfo.EthernetMac,
+			WirelessMac:         s.ECUInfo.WirelessMac,
+			PowerW:              s.ECUInfo.LastPower,
+			TodayEnergyWh:       s.ECUInfo.TodayEnergy,
+			LifetimeEnergyWh:    s.ECUInfo.LifetimeEnergy,
+		},
+		Inverters: []JSONInverter{},
+	}
+
+	for _, inv := range s.ArrayInfo.Inverters {
+		ji := JSONInverter{
+			InverterID:   inv.ID,
+			Model:        inv.Model,
+			Online:       inv.Online,
+			FrequencyHz:  inv.Frequency,
+			VoltageV:     inv.VoltageA,
+			TemperatureC: inv.Temperature,
+			PowerW:       inv.TotalPower(),
+			Channels:     []JSONChannel{},
+		}
+		if signal, ok := s.Signal(inv.ID); ok {
+			pct := SignalPercent(signal)
+			ji.SignalRaw, ji.SignalPct = &signal, &pct
+		}
+		for _, ch := range inv.Channels() {
+			ji.Channels = append(ji.Channels, JSONChannel{Channel: ch.Name, PowerW: ch.Power})
+		}
+		doc.Inverters = append(doc.Inverters, ji)
+	}
+
+	if includeRaw {
+		doc.Raw = &JSONRaw{
+			ECUInfo:            hex.EncodeToString(s.ECUInfo.Raw),
+			ArrayInfo:          hex.EncodeToString(s.ArrayInfo.Raw),
+			InverterSignalInfo: hex.EncodeToString(s.InverterSignalInfo.Raw),
+		}
+	}
+	return doc
+}
+
+// Snapshot converts the document back into a snapshot
+func (d JSONDocument) Snapshot() Snapshot {
+	s := Snapshot{
+		ECUResponse: ECUResponse{
+			ECUInfo: ECUInfo{
+				EcuID:               d.ECU.EcuID,
+				Version:             d.ECU.FirmwareVersion,
+				InvertersRegistered: d.ECU.InvertersRegistered,
+				InvertersOnline:     d.ECU.InvertersOnline,
+				EthernetMac:         d.ECU.EthernetMac,
+				WirelessMac:         d.ECU.WirelessMac,
+				LifetimeEnergy:      d.ECU.LifetimeEnergyWh,
+				TodayEnergy:         d.ECU.TodayEnergyWh,
+				LastPower:           d.ECU.PowerW,
+			},
+			ArrayInfo: ArrayInfo{Timestamp: d.Timestamp},
+		},
+		CollectedAt: d.CollectedAt,
+		ClockOffset: time.Duration(d.ClockOffsetS * float64(time.Second)),
+		Stale:       d.Stale,
+	}
+
+	for _, ji := range d.Inverters {
+		inv := InverterInfo{
+			ID:          ji.InverterID,
+			Online:      ji.Online,
+			Model:       ji.Model,
+			Frequency:   ji.FrequencyHz,
+			Temperature: ji.TemperatureC,
+			VoltageA:    ji.VoltageV,
+		}
+		for _, ch := range ji.Channels {
+			switch ch.Channel {
+			case "A":
+				inv.PowerA = ch.PowerW
+			case "B":
+				inv.PowerB = ch.PowerW
+			case "C":
+				inv.PowerC = ch.PowerW
+			case "D":
+				inv.PowerD = ch.PowerW
+			}
+		}
+		s.ArrayInfo.Inverters = append(s.ArrayInfo.Inverters, inv)
+		if ji.SignalRaw != nil {
+			s.InverterSignalInfo.Inverters = append(s.InverterSignalInfo.Inverters, InverterSignal{ID: ji.InverterID, Signal: *ji.SignalRaw})
+		}
+	}
+
+	if d.Raw != nil {
+		s.ECUInfo.Raw, _ = hex.DecodeString(d.Raw.ECUInfo)
+		s.ArrayInfo.Raw, _ = hex.DecodeString(d.Raw.ArrayInfo)
+		s.InverterSignalInfo.Raw, _ = hex.DecodeString(d.Raw.InverterSignalInfo)
+	}
+	return s
+}
+
+// decodeSnapshot decodes either a JSONDocument or a plain (Go field names)
+// Snapshot / ECUResponse
+func decodeSnapshot(raw json.RawMessage) (Snapshot, error) {
+	var probe struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return Snapshot{}, err
+	}
+	if probe.SchemaVersion > 0 {
+		var doc JSONDocument
+		err := json.Unmarshal(raw, &doc)
+		return doc.Snapshot(), err
+	}
+	var s Snapshot
+	err := json.Unmarshal(raw, &s)
+	return s, err
+}
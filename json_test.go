@@ -0,0 +1,71 @@
+package ecur
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONDocument(t *testing.T) {
+	s := testSnapshot(time.Date(2021, 10, 28, 10, 1, 0, 0, time.UTC))
+	s.ClockOffset = -time.Minute
+	s.ECUInfo.LastPower = 292
+	s.ECUInfo.Raw = []byte{0x41, 0x50, 0x53}
+	s.ArrayInfo.Inverters[0].PowerA = 57
+	s.ArrayInfo.Inverters[0].Frequency = 49.9
+	s.InverterSignalInfo.Inverters = []InverterSignal{{ID: "801000030000", Signal: 128}}
+
+	body, err := json.Marshal(NewJSONDocument(s, false))
+	require.NoError(t, err)
+	out := string(body)
+	require.Contains(t, out, `"schema_version":1`)
+	require.Contains(t, out, `"power_w":292`)
+	require.Contains(t, out, `"clock_offset_s":-60`)
+	require.Contains(t, out, `"signal_pct":50`)
+	require.Contains(t, out, `{"channel":"A","power_w":57}`)
+	require.NotContains(t, out, `"raw"`)
+
+	doc := NewJSONDocument(s, true)
+	require.Equal(t, "415053", doc.Raw.ECUInfo)
+
+	// Round trip through ReadSnapshots
+	body, err = json.Marshal(doc)
+	require.NoError(t, err)
+	snapshots, err := ReadSnapshots(bytes.NewReader(body))
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	require.Equal(t, s.ArrayInfo.Inverters, snapshots[0].ArrayInfo.Inverters)
+	require.Equal(t, s.InverterSignalInfo.Inverters, snapshots[0].InverterSignalInfo.Inverters)
+	require.Equal(t, s.ECUInfo, snapshots[0].ECUInfo)
+	require.Equal(t, s.ClockOffset, snapshots[0].ClockOffset)
+}
+
+// The published schema should describe every field of the JSON document
+func TestJSONSchemaMatchesDocument(t *testing.T) {
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(JSONSchema, &schema))
+
+	properties := func(node map[string]interface{}) map[string]interface{} {
+		return node["properties"].(map[string]interface{})
+	}
+	check := func(node map[string]interface{}, typ reflect.Type) {
+		props := properties(node)
+		for i := 0; i < typ.NumField(); i++ {
+			name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+			require.Contains(t, props, name, "schema misses %s.%s", typ.Name(), name)
+		}
+		require.Len(t, props, typ.NumField(), "schema has fields not in %s", typ.Name())
+	}
+
+	check(schema, reflect.TypeOf(JSONDocument{}))
+	check(properties(schema)["ecu"].(map[string]interface{}), reflect.TypeOf(JSONECU{}))
+	check(properties(schema)["raw"].(map[string]interface{}), reflect.TypeOf(JSONRaw{}))
+	inverter := properties(schema)["inverters"].(map[string]interface{})["items"].(map[string]interface{})
+	check(inverter, reflect.TypeOf(JSONInverter{}))
+	check(properties(inverter)["channels"].(map[string]interface{})["items"].(map[string]interface{}), reflect.TypeOf(JSONChannel{}))
+}
@@ -0,0 +1,237 @@
+package ecur
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	OrientationPortrait  = "portrait"
+	OrientationLandscape = "landscape"
+
+	// DefaultPanelWidth and DefaultPanelHeight are the dimensions, in metres,
+	// of a panel in portrait orientation
+	DefaultPanelWidth  = 1.0
+	DefaultPanelHeight = 1.7
+
+	// maxIntegrationGap is the longest interval between two ECU timestamps
+	// that is integrated into channel energy. Longer gaps are left out
+	maxIntegrationGap = 30 * time.Minute
+)
+
+// PanelID identifies the panel connected to a channel of an inverter
+type PanelID struct {
+	InverterID string
+	Channel    string
+}
+
+// PanelPosition places a panel on the roof. X and Y are the coordinates of
+// the top left corner in metres, with Y increasing down the roof
+type PanelPosition struct {
+	InverterID  string  `yaml:"inverter"`
+	Channel     string  `yaml:"channel"`
+	X           float64 `yaml:"x"`
+	Y           float64 `yaml:"y"`
+	Orientation string  `yaml:"orientation"` // portrait (default) or landscape
+}
+
+// RoofLayout describes where the panels of an installation are located
+type RoofLayout struct {
+	// Panel dimensions in portrait orientation, in metres
+	PanelWidth  float64         `yaml:"panel_width"`
+	PanelHeight float64         `yaml:"panel_height"`
+	Panels      []PanelPosition `yaml:"panels"`
+}
+
+// Validate checks that every panel has a valid orientation and appears once
+func (l RoofLayout) Validate() error {
+	seen := map[PanelID]bool{}
+	for _, p := range l.Panels {
+		id := PanelID{p.InverterID, p.Channel}
+		if p.InverterID == "" || p.Channel == "" {
+			return fmt.Errorf("panel at %g,%g: inverter and channel are required", p.X, p.Y)
+		}
+		if seen[id] {
+			return fmt.Errorf("panel %s/%s appears more than once", p.InverterID, p.Channel)
+		}
+		seen[id] = true
+		if p.Orientation != "" && p.Orientation != OrientationPortrait && p.Orientation != OrientationLandscape {
+			return fmt.Errorf("panel %s/%s: unknown orientation %q", p.InverterID, p.Channel, p.Orientation)
+		}
+	}
+	return nil
+}
+
+// size returns the width and height of a panel in metres
+func (l RoofLayout) size(p PanelPosition) (float64, float64) {
+	w, h := l.PanelWidth, l.PanelHeight
+	if w <= 0 {
+		w = DefaultPanelWidth
+	}
+	if h <= 0 {
+		h = DefaultPanelHeight
+	}
+	if p.Orientation == OrientationLandscape {
+		return h, w
+	}
+	return w, h
+}
+
+// ChannelPower returns the current power of every channel in the snapshot
+func ChannelPower(s Snapshot) map[PanelID]float64 {
+	power := map[PanelID]float64{}
+	for _, inv := range s.ArrayInfo.Inverters {
+		for _, ch := range inv.Channels() {
+			power[PanelID{inv.ID, ch.Name}] = float64(ch.Power)
+		}
+	}
+	return power
+}
+
+// ChannelEnergy integrates the channel power of consecutive snapshots into
+// the energy per channel, in Wh. Snapshots with the same ECU timestamp are
+// counted once, and gaps of more than 30 minutes are skipped
+func ChannelEnergy(snapshots []Snapshot) map[PanelID]float64 {
+	sorted := append([]Snapshot(nil), snapshots...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ArrayInfo.Timestamp.Before(sorted[j].ArrayInfo.Timestamp)
+	})
+
+	energy := map[PanelID]float64{}
+	for i := 1; i < len(sorted); i++ {
+		integrateChannels(energy, sorted[i-1], sorted[i])
+	}
+	return energy
+}
+
+// integrateChannels adds the energy produced between two snapshots, using
+// the mean power of each channel
+func integrateChannels(energy map[PanelID]float64, prev, next Snapshot) {
+	dt := next.ArrayInfo.Timestamp.Sub(prev.ArrayInfo.Timestamp)
+	if dt <= 0 || dt > maxIntegrationGap {
+		return
+	}
+	before := ChannelPower(prev)
+	for id, p := range ChannelPower(next) {
+		energy[id] += (before[id] + p) / 2 * dt.Hours()
+	}
+}
+
+// HeatmapOptions controls RenderHeatmapSVG
+type HeatmapOptions struct {
+	// Unit is shown with the values, e.g. "W" or "Wh"
+	Unit string
+	// Max is the value shown in the brightest colour. When zero, the
+	// highest value is used
+	Max float64
+	// Title is shown above the roof, when set
+	Title string
+}
+
+// svgScale is the number of SVG pixels per metre
+const svgScale = 100
+
+// RenderHeatmapSVG draws the roof layout as an SVG image, with every panel
+// coloured by its value, from dark (nothing) to bright yellow (Max). Panels
+// without a value are grey
+func RenderHeatmapSVG(w io.Writer, layout RoofLayout, values map[PanelID]float64, opts HeatmapOptions) error {
+	max := opts.Max
+	if max <= 0 {
+		for _, v := range values {
+			max = math.Max(max, v)
+		}
+	}
+
+	// Bounds of the roof, in metres
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range layout.Panels {
+		pw, ph := layout.size(p)
+		minX, minY = math.Min(minX, p.X), math.Min(minY, p.Y)
+		maxX, maxY = math.Max(maxX, p.X+pw), math.Max(maxY, p.Y+ph)
+	}
+	if len(layout.Panels) == 0 {
+		minX, minY, maxX, maxY = 0, 0, 1, 1
+	}
+
+	const margin, header, legend = 20.0, 30.0, 40.0
+	width := (maxX-minX)*svgScale + 2*margin
+	height := (maxY-minY)*svgScale + 2*margin + header + legend
+	px := func(x float64) float64 { return (x-minX)*svgScale + margin }
+	py := func(y float64) float64 { return (y-minY)*svgScale + margin + header }
+
+	b := &svgBuilder{w: w}
+	b.printf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %.0f %.0f" width="%.0f" height="%.0f" font-family="sans-serif">`+"\n", width, height, width, height)
+	b.printf(`<rect width="100%%" height="100%%" fill="#15181d"/>` + "\n")
+	if opts.Title != "" {
+		b.printf(`<text x="%.0f" y="%.0f" fill="#e6e6e6" font-size="16">%s</text>`+"\n", margin, margin+12, html.EscapeString(opts.Title))
+	}
+
+	for _, p := range layout.Panels {
+		pw, ph := layout.size(p)
+		x, y := px(p.X), py(p.Y)
+		fill, text := "#444c56", "#e6e6e6"
+		label := "–"
+		if v, ok := values[PanelID{p.InverterID, p.Channel}]; ok {
+			ratio := 0.0
+			if max > 0 {
+				ratio = v / max
+			}
+			fill = heatColour(ratio)
+			if ratio > 0.4 {
+				text = "#111111"
+			}
+			label = fmt.Sprintf("%.0f %s", v, opts.Unit)
+		}
+		b.printf(`<g><title>%s channel %s: %s</title>`, html.EscapeString(p.InverterID), html.EscapeString(p.Channel), label)
+		b.printf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="4" fill="%s" stroke="#15181d" stroke-width="2"/>`,
+			x, y, pw*svgScale, ph*svgScale, fill)
+		b.printf(`<text x="%.1f" y="%.1f" fill="%s" font-size="12" text-anchor="middle">%s</text>`,
+			x+pw*svgScale/2, y+ph*svgScale/2-4, text, html.EscapeString(shortID(p.InverterID)+"/"+p.Channel))
+		b.printf(`<text x="%.1f" y="%.1f" fill="%s" font-size="12" text-anchor="middle">%s</text></g>`+"\n",
+			x+pw*svgScale/2, y+ph*svgScale/2+12, text, label)
+	}
+
+	// Legend
+	ly := height - legend + 10
+	b.printf(`<defs><linearGradient id="heat">`)
+	for _, stop := range []float64{0, 0.5, 1} {
+		b.printf(`<stop offset="%.0f%%" stop-color="%s"/>`, stop*100, heatColour(stop))
+	}
+	b.printf(`</linearGradient></defs>` + "\n")
+	b.printf(`<rect x="%.0f" y="%.0f" width="150" height="10" fill="url(#heat)"/>`, margin, ly)
+	b.printf(`<text x="%.0f" y="%.0f" fill="#8b949e" font-size="11">0</text>`, margin, ly+24)
+	b.printf(`<text x="%.0f" y="%.0f" fill="#8b949e" font-size="11" text-anchor="end">%.0f %s</text>`+"\n", margin+150, ly+24, max, opts.Unit)
+	b.printf("</svg>\n")
+	return b.err
+}
+
+// heatColour maps 0..1 to a colour from dark brown to bright yellow
+func heatColour(ratio float64) string {
+	r := math.Max(0, math.Min(1, ratio))
+	return fmt.Sprintf("hsl(%.0f,%.0f%%,%.0f%%)", 20+25*r, 40+55*r, 18+42*r)
+}
+
+// shortID returns the last digits of an inverter ID, which is enough to
+// tell the inverters of an installation apart
+func shortID(id string) string {
+	if len(id) > 4 {
+		return id[len(id)-4:]
+	}
+	return id
+}
+
+// svgBuilder writes formatted output and keeps the first error
+type svgBuilder struct {
+	w   io.Writer
+	err error
+}
+
+func (b *svgBuilder) printf(format string, args ...interface{}) {
+	if b.err == nil {
+		_, b.err = fmt.Fprintf(b.w, format, args...)
+	}
+}
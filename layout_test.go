@@ -0,0 +1,113 @@
+package ecur
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testLayout() RoofLayout {
+	return RoofLayout{Panels: []PanelPosition{
+		{InverterID: "801000030000", Channel: "A", X: 0, Y: 0},
+		{InverterID: "801000030000", Channel: "B", X: 1, Y: 0},
+		{InverterID: "801000030001", Channel: "A", X: 0, Y: 1.7, Orientation: OrientationLandscape},
+		{InverterID: "801000039999", Channel: "A", X: 2, Y: 0},
+	}}
+}
+
+func TestRoofLayoutValidate(t *testing.T) {
+	require.NoError(t, testLayout().Validate())
+
+	l := testLayout()
+	l.Panels[1].Channel = "A"
+	require.Error(t, l.Validate())
+
+	l = testLayout()
+	l.Panels[0].Orientation = "diagonal"
+	require.Error(t, l.Validate())
+
+	l = testLayout()
+	l.Panels[0].Channel = ""
+	require.Error(t, l.Validate())
+}
+
+func TestChannelEnergy(t *testing.T) {
+	start := time.Date(2021, 10, 20, 12, 0, 0, 0, time.UTC)
+	snapshot := func(ts time.Time, power int) Snapshot {
+		s := testSnapshot(ts)
+		s.ArrayInfo.Timestamp = ts
+		s.ArrayInfo.Inverters = []InverterInfo{{ID: "801000030000", Model: "QS1", Online: true, PowerA: power}}
+		return s
+	}
+
+	energy := ChannelEnergy([]Snapshot{
+		snapshot(start.Add(10*time.Minute), 200),
+		snapshot(start, 100),
+		snapshot(start.Add(10*time.Minute), 200), // duplicate ECU timestamp
+		snapshot(start.Add(3*time.Hour), 200),    // after a gap
+	})
+	// Mean of 150 W for 10 minutes
+	require.InDelta(t, 25, energy[PanelID{"801000030000", "A"}], 0.001)
+	require.Equal(t, 0.0, energy[PanelID{"801000030000", "B"}])
+}
+
+func TestRenderHeatmapSVG(t *testing.T) {
+	values := map[PanelID]float64{
+		{"801000030000", "A"}: 100,
+		{"801000030000", "B"}: 50,
+		{"801000030001", "A"}: 0,
+	}
+	var buf bytes.Buffer
+	require.NoError(t, RenderHeatmapSVG(&buf, testLayout(), values, HeatmapOptions{Unit: "W", Title: "roof <1>"}))
+
+	// Well-formed XML with one group per panel
+	var doc struct {
+		ViewBox string `xml:"viewBox,attr"`
+		Groups  []struct {
+			Title string `xml:"title"`
+			Rect  struct {
+				Width string `xml:"width,attr"`
+				Fill  string `xml:"fill,attr"`
+			} `xml:"rect"`
+		} `xml:"g"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	require.Equal(t, "0 0 340 380", doc.ViewBox)
+	require.Len(t, doc.Groups, 4)
+	require.Equal(t, "801000030000 channel A: 100 W", doc.Groups[0].Title)
+	require.Equal(t, heatColour(1), doc.Groups[0].Rect.Fill)
+	require.Equal(t, heatColour(0.5), doc.Groups[1].Rect.Fill)
+	require.Equal(t, "170.0", doc.Groups[2].Rect.Width)  // landscape
+	require.Equal(t, "#444c56", doc.Groups[3].Rect.Fill) // no data
+}
+
+func TestAPIRoof(t *testing.T) {
+	c := testAPICollector(t)
+	srv := httptest.NewServer(APIHandler(c))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/ecus/216000011111/roof.svg")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	l := testLayout()
+	c.Layout = &l
+	for _, value := range []string{"", "current", "today"} {
+		resp, err = http.Get(srv.URL + "/api/v1/ecus/216000011111/roof.svg?value=" + value)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, value)
+		require.Equal(t, "image/svg+xml", resp.Header.Get("Content-Type"))
+	}
+
+	resp, err = http.Get(srv.URL + "/api/v1/ecus/216000011111/roof.svg?value=yesterday")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
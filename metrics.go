@@ -0,0 +1,111 @@
+package ecur
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// metricFamily collects the samples of a single Prometheus gauge
+type metricFamily struct {
+	name    string
+	help    string
+	samples []string
+}
+
+func (m *metricFamily) add(value float64, labels ...string) {
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		// %q escapes quotes, backslashes and newlines as the text format expects
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	m.samples = append(m.samples, fmt.Sprintf("%s{%s} %g", m.name, strings.Join(pairs, ","), value))
+}
+
+// WriteMetrics writes the snapshot as gauges in the Prometheus text
+// exposition format
+func WriteMetrics(w io.Writer, s Snapshot) error {
+	ecu := s.ECUInfo.EcuID
+	family := func(name, help string) *metricFamily {
+		return &metricFamily{name: "aps_" + name, help: help}
+	}
+
+	ecuPower := family("ecu_power_watts", "Current power output of the array")
+	energyToday := family("ecu_energy_today_watthours", "Energy produced today")
+	energyLifetime := family("ecu_energy_lifetime_watthours", "Energy produced over the lifetime of the ECU")
+	registered := family("ecu_inverters_registered", "Number of inverters registered with the ECU")
+	online := family("ecu_inverters_online", "Number of inverters online")
+	lastUpdate := family("ecu_timestamp_seconds", "ECU timestamp of the latest data as unix time")
+	clockOffset := family("ecu_clock_offset_seconds", "ECU timestamp minus host time at collection")
+	staleFor := family("ecu_stale_seconds", "Time the ECU has been serving the same timestamp")
+	stale := family("ecu_stale", "Whether the ECU data is considered stale (1) or not (0)")
+
+	ecuPower.add(float64(s.ECUInfo.LastPower), "ecu_id", ecu)
+	energyToday.add(float64(s.ECUInfo.TodayEnergy), "ecu_id", ecu)
+	energyLifetime.add(float64(s.ECUInfo.LifetimeEnergy), "ecu_id", ecu)
+	registered.add(float64(s.ECUInfo.InvertersRegistered), "ecu_id", ecu)
+	online.add(float64(s.ECUInfo.InvertersOnline), "ecu_id", ecu)
+	lastUpdate.add(float64(s.ArrayInfo.Timestamp.Unix()), "ecu_id", ecu)
+	clockOffset.add(s.ClockOffset.Seconds(), "ecu_id", ecu)
+	staleFor.add(s.StaleFor.Seconds(), "ecu_id", ecu)
+	stale.add(boolToFloat(s.Stale), "ecu_id", ecu)
+
+	invOnline := family("inverter_online", "Whether the inverter is online (1) or not (0)")
+	frequency := family("inverter_frequency_hertz", "Grid frequency measured by the inverter")
+	voltage := family("inverter_voltage_volts", "Grid voltage measured by the inverter")
+	temperature := family("inverter_temperature_celsius", "Inverter temperature")
+	signal := family("inverter_signal_percent", "Zigbee signal strength between ECU and inverter")
+	channelPower := family("channel_power_watts", "Power output per inverter channel")
+
+	for _, inv := range s.ArrayInfo.Inverters {
+		labels := []string{"ecu_id", ecu, "inverter_id", inv.ID}
+		invOnline.add(boolToFloat(inv.Online), labels...)
+		frequency.add(inv.Frequency, labels...)
+		voltage.add(float64(inv.VoltageA), labels...)
+		temperature.add(float64(inv.Temperature), labels...)
+		if sig, ok := s.Signal(inv.ID); ok {
+			signal.add(SignalPercent(sig), labels...)
+		}
+		for _, ch := range inv.Channels() {
+			channelPower.add(float64(ch.Power), append(labels, "channel", ch.Name)...)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, m := range []*metricFamily{
+		ecuPower, energyToday, energyLifetime, registered, online, lastUpdate, clockOffset, staleFor, stale,
+		invOnline, frequency, voltage, temperature, signal, channelPower,
+	} {
+		if len(m.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, sample := range m.samples {
+			fmt.Fprintln(bw, sample)
+		}
+	}
+	return bw.Flush()
+}
+
+// MetricsHandler serves the latest snapshot of the collector in the
+// Prometheus text format. Scrapes never trigger a read from the ECU-R
+func MetricsHandler(c *Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := c.Latest()
+		if !ok {
+			http.Error(w, "no data collected yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteMetrics(w, s)
+	})
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
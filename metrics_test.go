@@ -0,0 +1,51 @@
+package ecur
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	s := testSnapshot(time.Now())
+	s.ECUInfo.LastPower = 292
+	s.ArrayInfo.Inverters[0].PowerC = 57
+	s.ArrayInfo.Inverters[0].Frequency = 50.1
+	s.InverterSignalInfo.Inverters = []InverterSignal{{ID: "801000030000", Signal: 128}}
+	s.Stale = true
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteMetrics(&buf, s))
+	out := buf.String()
+
+	require.Contains(t, out, "# TYPE aps_ecu_power_watts gauge\n")
+	require.Contains(t, out, `aps_ecu_power_watts{ecu_id="216000011111"} 292`)
+	require.Contains(t, out, `aps_ecu_energy_today_watthours{ecu_id="216000011111"} 3960`)
+	require.Contains(t, out, `aps_ecu_stale{ecu_id="216000011111"} 1`)
+	require.Contains(t, out, `aps_inverter_frequency_hertz{ecu_id="216000011111",inverter_id="801000030000"} 50.1`)
+	require.Contains(t, out, `aps_inverter_signal_percent{ecu_id="216000011111",inverter_id="801000030000"} 50`)
+	require.NotContains(t, out, `aps_inverter_signal_percent{ecu_id="216000011111",inverter_id="801000030001"}`)
+	require.Contains(t, out, `aps_channel_power_watts{ecu_id="216000011111",inverter_id="801000030000",channel="C"} 57`)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	src := &fakeSource{responses: []ECUResponse{testSnapshot(time.Now()).ECUResponse}}
+	c := NewCollector(src, time.Minute)
+	handler := MetricsHandler(c)
+
+	// No data yet
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	_, err := c.Poll()
+	require.NoError(t, err)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "aps_ecu_inverters_registered")
+}
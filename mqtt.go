@@ -0,0 +1,415 @@
+package ecur
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMQTTTopicPrefix     = "aps"
+	DefaultMQTTDiscoveryPrefix = "homeassistant"
+	DefaultMQTTKeepAlive       = 60 * time.Second
+)
+
+// MQTT control packet types (MQTT 3.1.1)
+const (
+	mqttConnect    byte = 0x10
+	mqttConnAck    byte = 0x20
+	mqttPublish    byte = 0x30
+	mqttPingReq    byte = 0xC0
+	mqttDisconnect byte = 0xE0
+)
+
+// MQTTOptions configures an MQTTPublisher
+type MQTTOptions struct {
+	// Broker is the broker URL, e.g. tcp://localhost:1883 or ssl://broker:8883
+	Broker   string
+	ClientID string
+	Username string
+	// Password is only sent with a Username
+	Password string
+	// TLSConfig is used for ssl://, tls:// and mqtts:// brokers. When nil a
+	// default configuration for the broker host is used
+	TLSConfig *tls.Config
+	KeepAlive time.Duration
+	// TopicPrefix is the root of all state topics
+	TopicPrefix string
+	// DiscoveryPrefix is the Home Assistant discovery prefix. Leave empty
+	// to disable discovery messages
+	DiscoveryPrefix string
+}
+
+// MQTTPublisher publishes snapshots as retained per-entity topics, together
+// with Home Assistant discovery configurations. It implements Sink
+type MQTTPublisher struct {
+	opts MQTTOptions
+
+	mu         sync.Mutex
+	conn       net.Conn
+	discovered map[string]bool
+	done       chan struct{}
+}
+
+func NewMQTTPublisher(opts MQTTOptions) *MQTTPublisher {
+	if opts.ClientID == "" {
+		opts.ClientID = "aps-ecur"
+	}
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = DefaultMQTTKeepAlive
+	}
+	if opts.TopicPrefix == "" {
+		opts.TopicPrefix = DefaultMQTTTopicPrefix
+	}
+	return &MQTTPublisher{
+		opts:       opts,
+		discovered: map[string]bool{},
+	}
+}
+
+// AvailabilityTopic is the topic on which the publisher announces 'online'.
+// The broker publishes 'offline' (last will) when the connection is lost
+func (p *MQTTPublisher) AvailabilityTopic() string {
+	return p.opts.TopicPrefix + "/status"
+}
+
+// Connect connects to the broker and announces availability
+func (p *MQTTPublisher) Connect() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.connect()
+}
+
+func (p *MQTTPublisher) connect() error {
+	u, err := url.Parse(p.opts.Broker)
+	if err != nil {
+		return fmt.Errorf("invalid broker url %q: %w", p.opts.Broker, err)
+	}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = net.DialTimeout("tcp", u.Host, 10*time.Second)
+	case "ssl", "tls", "mqtts":
+		cfg := p.opts.TLSConfig
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: u.Hostname()}
+		}
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", u.Host, cfg)
+	default:
+		return fmt.Errorf("unsupported broker scheme %q: %w", u.Scheme, ErrCouldNotConnect)
+	}
+	if err != nil {
+		return fmt.Errorf("could not connect to broker: %w", err)
+	}
+
+	if _, err := conn.Write(p.connectPacket()); err != nil {
+		conn.Close()
+		return fmt.Errorf("could not send connect packet: %w", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	packetType, body, err := readMQTTPacket(bufio.NewReader(conn))
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("could not read connack: %w", err)
+	}
+	if packetType != mqttConnAck || len(body) != 2 {
+		conn.Close()
+		return fmt.Errorf("unexpected response to connect (type %#x): %w", packetType, ErrMalformedBody)
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return fmt.Errorf("broker refused connection with return code %d: %w", body[1], ErrCouldNotConnect)
+	}
+
+	p.conn = conn
+	p.discovered = map[string]bool{}
+	p.done = make(chan struct{})
+	go p.keepAlive(conn, p.done)
+	go p.drain(conn)
+
+	return p.publish(p.AvailabilityTopic(), []byte("online"), true)
+}
+
+// Write publishes the snapshot, reconnecting to the broker if required
+func (p *MQTTPublisher) Write(s Snapshot) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range p.messages(s) {
+		if err := p.publish(m.topic, m.payload, true); err != nil {
+			p.disconnect()
+			return fmt.Errorf("could not publish to %s: %w", m.topic, err)
+		}
+	}
+	return nil
+}
+
+// Close announces that the publisher goes offline and disconnects
+func (p *MQTTPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return ErrNotConnected
+	}
+	p.publish(p.AvailabilityTopic(), []byte("offline"), true)
+	p.conn.Write([]byte{mqttDisconnect, 0})
+	return p.disconnect()
+}
+
+func (p *MQTTPublisher) disconnect() error {
+	close(p.done)
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+// keepAlive pings the broker at half the keep alive interval
+func (p *MQTTPublisher) keepAlive(conn net.Conn, done chan struct{}) {
+	ticker := time.NewTicker(p.opts.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			if p.conn == conn {
+				conn.Write([]byte{mqttPingReq, 0})
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// drain reads and discards incoming packets (ping responses), so that the
+// broker never blocks on a full connection
+func (p *MQTTPublisher) drain(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		if _, _, err := readMQTTPacket(r); err != nil {
+			return
+		}
+	}
+}
+
+func (p *MQTTPublisher) publish(topic string, payload []byte, retain bool) error {
+	header := mqttPublish
+	if retain {
+		header |= 0x01
+	}
+	body := append(mqttString(topic), payload...)
+	_, err := p.conn.Write(mqttPacket(header, body))
+	return err
+}
+
+func (p *MQTTPublisher) connectPacket() []byte {
+	flags := byte(0x02)  // clean session
+	flags |= 0x04 | 0x20 // last will, retained
+	if p.opts.Username != "" {
+		flags |= 0x80
+	}
+	// A password without user name is not allowed (MQTT 3.1.1, 3.1.2.9)
+	if p.opts.Username != "" && p.opts.Password != "" {
+		flags |= 0x40
+	}
+
+	body := mqttString("MQTT")
+	body = append(body, 4, flags) // protocol level 3.1.1
+	keepAlive := make([]byte, 2)
+	binary.BigEndian.PutUint16(keepAlive, uint16(p.opts.KeepAlive.Seconds()))
+	body = append(body, keepAlive...)
+	body = append(body, mqttString(p.opts.ClientID)...)
+	body = append(body, mqttString(p.AvailabilityTopic())...)
+	body = append(body, mqttString("offline")...)
+	if p.opts.Username != "" {
+		body = append(body, mqttString(p.opts.Username)...)
+	}
+	if p.opts.Username != "" && p.opts.Password != "" {
+		body = append(body, mqttString(p.opts.Password)...)
+	}
+	return mqttPacket(mqttConnect, body)
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+}
+
+// haDevice is a Home Assistant device description
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+	ViaDevice    string   `json:"via_device,omitempty"`
+}
+
+// haEntity is a Home Assistant discovery configuration
+type haEntity struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	StateTopic        string   `json:"state_topic"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	Unit              string   `json:"unit_of_measurement,omitempty"`
+	PayloadOn         string   `json:"payload_on,omitempty"`
+	PayloadOff        string   `json:"payload_off,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+// messages returns the state messages for the snapshot, preceded by the
+// discovery messages for entities that have not been announced yet
+func (p *MQTTPublisher) messages(s Snapshot) []mqttMessage {
+	var discovery, state []mqttMessage
+	ecu := s.ECUInfo.EcuID
+
+	// path holds the topic levels below the prefix: the ECU, inverter and
+	// channel as far as applicable, and the metric
+	add := func(component, name string, device haDevice, value string, e haEntity, path ...string) {
+		id := strings.Join(path, "_")
+		topic := p.opts.TopicPrefix + "/" + strings.Join(path, "/")
+		state = append(state, mqttMessage{topic, []byte(value)})
+
+		if p.opts.DiscoveryPrefix == "" || p.discovered[id] {
+			return
+		}
+		p.discovered[id] = true
+		e.Name = name
+		e.UniqueID = "aps_" + id
+		e.StateTopic = topic
+		e.AvailabilityTopic = p.AvailabilityTopic()
+		e.Device = device
+		config, _ := json.Marshal(e)
+		discovery = append(discovery, mqttMessage{
+			topic:   fmt.Sprintf("%s/%s/%s/config", p.opts.DiscoveryPrefix, component, e.UniqueID),
+			payload: config,
+		})
+	}
+
+	ecuDevice := haDevice{
+		Identifiers:  []string{"aps_" + ecu},
+		Name:         "ECU " + ecu,
+		Manufacturer: "APsystems",
+		Model:        "ECU-R",
+		SWVersion:    s.ECUInfo.Version,
+	}
+	power := haEntity{DeviceClass: "power", StateClass: "measurement", Unit: "W"}
+	energy := haEntity{DeviceClass: "energy", StateClass: "total_increasing", Unit: "Wh"}
+
+	add("sensor", "Power", ecuDevice, fmt.Sprint(s.ECUInfo.LastPower), power, ecu, "power")
+	add("sensor", "Energy today", ecuDevice, fmt.Sprint(s.ECUInfo.TodayEnergy), energy, ecu, "energy_today")
+	add("sensor", "Lifetime energy", ecuDevice, fmt.Sprint(s.ECUInfo.LifetimeEnergy), energy, ecu, "energy_lifetime")
+	add("sensor", "Inverters online", ecuDevice, fmt.Sprint(s.ECUInfo.InvertersOnline),
+		haEntity{StateClass: "measurement"}, ecu, "inverters_online")
+
+	for _, inv := range s.ArrayInfo.Inverters {
+		invDevice := haDevice{
+			Identifiers:  []string{"aps_" + inv.ID},
+			Name:         "Inverter " + inv.ID,
+			Manufacturer: "APsystems",
+			Model:        inv.Model,
+			ViaDevice:    "aps_" + ecu,
+		}
+		online := "OFF"
+		if inv.Online {
+			online = "ON"
+		}
+		add("binary_sensor", "Online", invDevice, online,
+			haEntity{DeviceClass: "connectivity", PayloadOn: "ON", PayloadOff: "OFF"}, ecu, inv.ID, "online")
+		add("sensor", "Temperature", invDevice, fmt.Sprint(inv.Temperature),
+			haEntity{DeviceClass: "temperature", StateClass: "measurement", Unit: "°C"}, ecu, inv.ID, "temperature")
+		add("sensor", "Grid frequency", invDevice, fmt.Sprint(inv.Frequency),
+			haEntity{DeviceClass: "frequency", StateClass: "measurement", Unit: "Hz"}, ecu, inv.ID, "frequency")
+		add("sensor", "Grid voltage", invDevice, fmt.Sprint(inv.VoltageA),
+			haEntity{DeviceClass: "voltage", StateClass: "measurement", Unit: "V"}, ecu, inv.ID, "voltage")
+		if signal, ok := s.Signal(inv.ID); ok {
+			add("sensor", "Signal strength", invDevice, fmt.Sprintf("%.1f", SignalPercent(signal)),
+				haEntity{StateClass: "measurement", Unit: "%"}, ecu, inv.ID, "signal")
+		}
+
+		for _, ch := range inv.Channels() {
+			chDevice := haDevice{
+				Identifiers:  []string{"aps_" + inv.ID + "_" + ch.Name},
+				Name:         fmt.Sprintf("Inverter %s channel %s", inv.ID, ch.Name),
+				Manufacturer: "APsystems",
+				Model:        inv.Model + " channel",
+				ViaDevice:    "aps_" + inv.ID,
+			}
+			add("sensor", "Power", chDevice, fmt.Sprint(ch.Power), power, ecu, inv.ID, ch.Name, "power")
+		}
+	}
+
+	return append(discovery, state...)
+}
+
+// mqttPacket prefixes the body with a fixed header
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	// Remaining length, variable length encoded
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// mqttString encodes a length prefixed UTF-8 string
+func mqttString(s string) []byte {
+	b := make([]byte, 2, 2+len(s))
+	binary.BigEndian.PutUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readMQTTPacket reads a single control packet and returns its type and body
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, fmt.Errorf("invalid remaining length: %w", ErrMalformedBody)
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xF0, body, nil
+}
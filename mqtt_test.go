@@ -0,0 +1,138 @@
+package ecur
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBroker accepts a single connection, acknowledges the CONNECT packet
+// and forwards all received packets
+func fakeBroker(t *testing.T) (string, chan []byte, chan map[string]string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	connect := make(chan []byte, 1)
+	published := make(chan map[string]string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		_, body, err := readMQTTPacket(r)
+		if err != nil {
+			return
+		}
+		connect <- body
+		conn.Write([]byte{mqttConnAck, 2, 0, 0})
+
+		messages := map[string]string{}
+		for {
+			packetType, body, err := readMQTTPacket(r)
+			if err != nil || packetType == mqttDisconnect {
+				published <- messages
+				return
+			}
+			if packetType == mqttPublish {
+				n := binary.BigEndian.Uint16(body[0:2])
+				messages[string(body[2:2+n])] = string(body[2+n:])
+			}
+		}
+	}()
+	return "tcp://" + l.Addr().String(), connect, published
+}
+
+func TestMQTTPublisher(t *testing.T) {
+	broker, connect, published := fakeBroker(t)
+	p := NewMQTTPublisher(MQTTOptions{
+		Broker:          broker,
+		Username:        "user",
+		Password:        "secret",
+		DiscoveryPrefix: DefaultMQTTDiscoveryPrefix,
+	})
+
+	s := testSnapshot(time.Now())
+	s.ECUInfo.LastPower = 292
+	s.ArrayInfo.Inverters[0].PowerB = 57
+	require.NoError(t, p.Write(s))
+	require.NoError(t, p.Close())
+
+	// CONNECT carries the last will and credentials
+	body := <-connect
+	require.Equal(t, byte(0x02|0x04|0x20|0x40|0x80), body[7])
+	require.Contains(t, string(body), "aps/status")
+	require.Contains(t, string(body), "offline")
+	require.Contains(t, string(body), "secret")
+
+	messages := <-published
+	require.Equal(t, "offline", messages["aps/status"])
+	require.Equal(t, "292", messages["aps/216000011111/power"])
+	require.Equal(t, "ON", messages["aps/216000011111/801000030000/online"])
+	require.Equal(t, "57", messages["aps/216000011111/801000030000/B/power"])
+
+	var config map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(messages["homeassistant/sensor/aps_216000011111_801000030000_B_power/config"]), &config))
+	require.Equal(t, "power", config["device_class"])
+	require.Equal(t, "W", config["unit_of_measurement"])
+	require.Equal(t, "measurement", config["state_class"])
+	require.Equal(t, "aps/216000011111/801000030000/B/power", config["state_topic"])
+	require.Equal(t, "aps_801000030000", config["device"].(map[string]interface{})["via_device"])
+
+	require.NoError(t, json.Unmarshal([]byte(messages["homeassistant/sensor/aps_216000011111_energy_lifetime/config"]), &config))
+	require.Equal(t, "total_increasing", config["state_class"])
+}
+
+func TestMQTTTopics(t *testing.T) {
+	p := NewMQTTPublisher(MQTTOptions{})
+	s := testSnapshot(time.Now())
+	s.ArrayInfo.Inverters = s.ArrayInfo.Inverters[:1]
+	s.InverterSignalInfo.Inverters = []InverterSignal{{ID: "801000030000", Signal: 128}}
+
+	var topics []string
+	for _, m := range p.messages(s) {
+		topics = append(topics, m.topic)
+	}
+	require.Equal(t, []string{
+		"aps/216000011111/power",
+		"aps/216000011111/energy_today",
+		"aps/216000011111/energy_lifetime",
+		"aps/216000011111/inverters_online",
+		"aps/216000011111/801000030000/online",
+		"aps/216000011111/801000030000/temperature",
+		"aps/216000011111/801000030000/frequency",
+		"aps/216000011111/801000030000/voltage",
+		"aps/216000011111/801000030000/signal",
+		"aps/216000011111/801000030000/A/power",
+		"aps/216000011111/801000030000/B/power",
+		"aps/216000011111/801000030000/C/power",
+		"aps/216000011111/801000030000/D/power",
+	}, topics)
+}
+
+func TestMQTTConnectPasswordWithoutUsername(t *testing.T) {
+	p := NewMQTTPublisher(MQTTOptions{Password: "secret"})
+	packet := p.connectPacket()
+	body := packet[2:]
+	require.Equal(t, byte(0x02|0x04|0x20), body[7])
+	require.NotContains(t, string(body), "secret")
+}
+
+func TestMQTTPacketLength(t *testing.T) {
+	packet := mqttPacket(mqttPublish, make([]byte, 321))
+	require.Equal(t, []byte{mqttPublish, 0xC1, 0x02}, packet[:3])
+
+	packetType, body, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(packet)))
+	require.NoError(t, err)
+	require.Equal(t, mqttPublish, packetType)
+	require.Len(t, body, 321)
+}
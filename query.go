@@ -0,0 +1,169 @@
+package ecur
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// AggFunc selects how Store.Aggregate combines the samples of an interval
+type AggFunc string
+
+const (
+	// AggAvg is the average power in W
+	AggAvg AggFunc = "avg"
+	// AggMax is the highest power in W
+	AggMax AggFunc = "max"
+	// AggSum is the energy produced in Wh
+	AggSum AggFunc = "sum"
+)
+
+// SeriesPoint is the aggregated value of a channel over an interval
+type SeriesPoint struct {
+	Start      time.Time `json:"start"`
+	EcuID      string    `json:"ecu_id"`
+	InverterID string    `json:"inverter_id"`
+	Channel    string    `json:"channel"`
+	Value      float64   `json:"value"`
+	Samples    int       `json:"samples"`
+}
+
+type aggState struct {
+	point  SeriesPoint
+	sum    float64 // of power, for the average
+	max    float64
+	energy float64
+}
+
+// Aggregate combines the stored channel samples matching q into intervals
+// of the given length, aligned to midnight (ECU time) when the interval
+// divides a day. An interval of zero aggregates the whole range. Raw
+// samples are used where available; older periods, of which the raw data
+// has been pruned, are taken from the hourly rollups
+func (st *Store) Aggregate(q Query, interval time.Duration, fn AggFunc) ([]SeriesPoint, error) {
+	if fn != AggAvg && fn != AggMax && fn != AggSum {
+		return nil, fmt.Errorf("unknown aggregation function %q, use avg, max or sum", fn)
+	}
+	if interval < 0 || interval > 0 && interval < time.Minute {
+		return nil, fmt.Errorf("invalid interval %s, use at least a minute", interval)
+	}
+
+	ecus := []string{q.EcuID}
+	if q.EcuID == "" {
+		var err error
+		if ecus, err = st.ECUs(); err != nil {
+			return nil, err
+		}
+	}
+
+	states := map[rollupKey]*aggState{}
+	state := func(t time.Time, ecuID, inverterID, channel string) *aggState {
+		start := bucketStart(t, interval, q.From)
+		key := rollupKey{start.Unix(), ecuID, inverterID, channel}
+		s, ok := states[key]
+		if !ok {
+			s = &aggState{
+				point: SeriesPoint{Start: start, EcuID: ecuID, InverterID: inverterID, Channel: channel},
+				max:   math.Inf(-1),
+			}
+			states[key] = s
+		}
+		if interval == 0 && q.From.IsZero() && (s.point.Start.IsZero() || t.Before(s.point.Start)) {
+			s.point.Start = t
+		}
+		return s
+	}
+
+	for _, ecuID := range ecus {
+		sq := q
+		sq.EcuID = ecuID
+
+		// Rollups only for the days without raw data
+		st.mu.RLock()
+		days, err := st.segmentDays(ecuID)
+		st.mu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		rollups, err := st.Rollups(ResolutionHour, sq)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rollups {
+			if r.InverterID == "" || len(days) > 0 && r.Start.Format(segmentDayFmt) >= days[0] {
+				continue
+			}
+			s := state(r.Start, ecuID, r.InverterID, r.Channel)
+			s.point.Samples += r.Samples
+			s.sum += r.AvgPowerW * float64(r.Samples)
+			s.max = math.Max(s.max, r.MaxPowerW)
+			s.energy += r.EnergyWh
+		}
+
+		samples, err := st.Query(sq)
+		if err != nil {
+			return nil, err
+		}
+		prev := map[PanelID]Sample{}
+		for _, sample := range samples {
+			s := state(sample.Time, ecuID, sample.InverterID, sample.Channel)
+			s.point.Samples++
+			s.sum += sample.PowerW
+			s.max = math.Max(s.max, sample.PowerW)
+
+			// Energy since the previous sample belongs to the interval of
+			// the previous sample
+			id := PanelID{sample.InverterID, sample.Channel}
+			if p, ok := prev[id]; ok {
+				if dt := sample.Time.Sub(p.Time); dt > 0 && dt <= maxIntegrationGap {
+					state(p.Time, ecuID, p.InverterID, p.Channel).energy += (p.PowerW + sample.PowerW) / 2 * dt.Hours()
+				}
+			}
+			prev[id] = sample
+		}
+	}
+
+	points := make([]SeriesPoint, 0, len(states))
+	for _, s := range states {
+		if s.point.Samples == 0 {
+			continue
+		}
+		switch fn {
+		case AggAvg:
+			s.point.Value = s.sum / float64(s.point.Samples)
+		case AggMax:
+			s.point.Value = s.max
+		case AggSum:
+			s.point.Value = s.energy
+		}
+		points = append(points, s.point)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		a, b := points[i], points[j]
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		if a.EcuID != b.EcuID {
+			return a.EcuID < b.EcuID
+		}
+		if a.InverterID != b.InverterID {
+			return a.InverterID < b.InverterID
+		}
+		return a.Channel < b.Channel
+	})
+	return points, nil
+}
+
+// bucketStart returns the start of the interval containing t
+func bucketStart(t time.Time, interval time.Duration, from time.Time) time.Time {
+	if interval == 0 {
+		return from
+	}
+	if interval <= 24*time.Hour && (24*time.Hour)%interval == 0 {
+		midnight := ResolutionDay.periodStart(t)
+		return midnight.Add(t.Sub(midnight) / interval * interval)
+	}
+	secs := int64(interval / time.Second)
+	return time.Unix(t.Unix()/secs*secs, 0).In(t.Location())
+}
@@ -0,0 +1,69 @@
+package ecur
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreAggregate(t *testing.T) {
+	st, err := OpenStore(t.TempDir())
+	require.NoError(t, err)
+	st.Retention = 24 * time.Hour
+
+	// Three days of 100 W, 200 W and 100 W readings at 12:00, 12:30 and 13:00.
+	// The raw data of the first day is pruned, leaving its rollups
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	for d := 0; d < 3; d++ {
+		for i, p := range []int{100, 200, 100} {
+			ts := start.AddDate(0, 0, d).Add(time.Duration(i) * 30 * time.Minute)
+			require.NoError(t, st.Write(storeSnapshot(ts, p)))
+		}
+	}
+
+	q := Query{InverterID: "801000030000", Channel: "A"}
+	points, err := st.Aggregate(q, time.Hour, AggAvg)
+	require.NoError(t, err)
+	require.Len(t, points, 6)
+	require.Equal(t, start, points[0].Start.UTC())
+	require.Equal(t, 150.0, points[0].Value)
+	require.Equal(t, 2, points[0].Samples)
+	require.Equal(t, 100.0, points[1].Value)
+
+	// Whole days, from rollups (day 1) and raw data (day 2 and 3)
+	points, err = st.Aggregate(q, 24*time.Hour, AggSum)
+	require.NoError(t, err)
+	require.Len(t, points, 3)
+	for _, p := range points {
+		require.InDelta(t, 150, p.Value, 0.001)
+		require.Equal(t, 3, p.Samples)
+	}
+
+	// The whole range
+	q.From = start.Add(-time.Hour)
+	points, err = st.Aggregate(q, 0, AggMax)
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+	require.Equal(t, 200.0, points[0].Value)
+	require.Equal(t, 9, points[0].Samples)
+	require.Equal(t, q.From, points[0].Start)
+
+	// All channels of both inverters
+	points, err = st.Aggregate(Query{From: start.AddDate(0, 0, 2)}, 0, AggMax)
+	require.NoError(t, err)
+	require.Len(t, points, 8)
+
+	_, err = st.Aggregate(q, time.Hour, "median")
+	require.Error(t, err)
+	_, err = st.Aggregate(q, time.Second, AggAvg)
+	require.Error(t, err)
+}
+
+func TestBucketStart(t *testing.T) {
+	zone := time.FixedZone("IST", 5*3600+1800)
+	ts := time.Date(2021, 6, 1, 12, 40, 0, 0, zone)
+	require.Equal(t, time.Date(2021, 6, 1, 12, 0, 0, 0, zone), bucketStart(ts, time.Hour, time.Time{}))
+	require.Equal(t, time.Date(2021, 6, 1, 0, 0, 0, 0, zone), bucketStart(ts, 24*time.Hour, time.Time{}))
+	require.Equal(t, time.Date(2021, 6, 1, 12, 30, 0, 0, zone), bucketStart(ts, 15*time.Minute, time.Time{}))
+}
@@ -0,0 +1,385 @@
+package ecur
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Resolution is the period covered by a rollup
+type Resolution string
+
+const (
+	ResolutionHour  Resolution = "hour"
+	ResolutionDay   Resolution = "day"
+	ResolutionMonth Resolution = "month"
+
+	// DefaultRetention is the suggested period to keep raw snapshots for;
+	// older data is only kept as rollups
+	DefaultRetention = 90 * 24 * time.Hour
+
+	storeRollupDir = "rollup"
+)
+
+// Rollup aggregates the power of a channel, or of the whole ECU-R when
+// InverterID and Channel are empty, over an hour, day or month
+type Rollup struct {
+	Start      time.Time  `json:"start"`
+	Resolution Resolution `json:"resolution"`
+	EcuID      string     `json:"ecu_id"`
+	InverterID string     `json:"inverter_id,omitempty"`
+	Channel    string     `json:"channel,omitempty"`
+	Samples    int        `json:"samples"`
+	MinPowerW  float64    `json:"min_power_w"`
+	MaxPowerW  float64    `json:"max_power_w"`
+	AvgPowerW  float64    `json:"avg_power_w"`
+	// EnergyWh is integrated from the collected power samples
+	EnergyWh float64 `json:"energy_wh"`
+	// ReportedEnergyWh is the production according to the energy counter of
+	// the ECU-R, for ECU rollups only. It allows to cross-check EnergyWh
+	// against the history of the ECU-R itself
+	ReportedEnergyWh float64 `json:"reported_energy_wh,omitempty"`
+}
+
+// periodStart returns the start of the period containing t, in the location
+// of t
+func (r Resolution) periodStart(t time.Time) time.Time {
+	switch r {
+	case ResolutionHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case ResolutionDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+type rollupKey struct {
+	start      int64
+	ecuID      string
+	inverterID string
+	channel    string
+}
+
+// RollupSnapshots aggregates snapshots into hourly rollups for the ECU-R and
+// every channel. Energy between two consecutive snapshots is attributed to
+// the hour of the first, and gaps of more than 30 minutes are not integrated
+func RollupSnapshots(snapshots []Snapshot) []Rollup {
+	snapshots = dedupeSnapshots(append([]Snapshot(nil), snapshots...))
+
+	rollups := map[rollupKey]*Rollup{}
+	add := func(s Snapshot, inverterID, channel string, power float64) *Rollup {
+		start := ResolutionHour.periodStart(s.ArrayInfo.Timestamp)
+		key := rollupKey{start.Unix(), s.ECUInfo.EcuID, inverterID, channel}
+		r, ok := rollups[key]
+		if !ok {
+			r = &Rollup{
+				Start:      start,
+				Resolution: ResolutionHour,
+				EcuID:      s.ECUInfo.EcuID,
+				InverterID: inverterID,
+				Channel:    channel,
+				MinPowerW:  math.Inf(1),
+				MaxPowerW:  math.Inf(-1),
+			}
+			rollups[key] = r
+		}
+		r.Samples++
+		r.MinPowerW = math.Min(r.MinPowerW, power)
+		r.MaxPowerW = math.Max(r.MaxPowerW, power)
+		r.AvgPowerW += power // divided by Samples below
+		return r
+	}
+
+	// Energy counter of the ECU at the end of the previous hour, per ECU
+	counters := map[string]Snapshot{}
+	prevByECU := map[string]Snapshot{}
+	for _, s := range snapshots {
+		ecuID := s.ECUInfo.EcuID
+		r := add(s, "", "", float64(s.ECUInfo.LastPower))
+
+		prev, hasPrev := prevByECU[ecuID]
+		dt := time.Duration(0)
+		if hasPrev {
+			dt = s.ArrayInfo.Timestamp.Sub(prev.ArrayInfo.Timestamp)
+		}
+		integrate := hasPrev && dt > 0 && dt <= maxIntegrationGap
+		prevRollup := func(inverterID, channel string) *Rollup {
+			start := ResolutionHour.periodStart(prev.ArrayInfo.Timestamp)
+			return rollups[rollupKey{start.Unix(), ecuID, inverterID, channel}]
+		}
+		if integrate {
+			prevRollup("", "").EnergyWh += float64(prev.ECUInfo.LastPower+s.ECUInfo.LastPower) / 2 * dt.Hours()
+		}
+
+		// The ECU counter restarts every day
+		counter, ok := counters[ecuID]
+		if !ok || !sameDay(counter.ArrayInfo.Timestamp, s.ArrayInfo.Timestamp) {
+			counter = Snapshot{}
+		}
+		if hasPrev && sameDay(prev.ArrayInfo.Timestamp, s.ArrayInfo.Timestamp) &&
+			ResolutionHour.periodStart(prev.ArrayInfo.Timestamp).Before(r.Start) {
+			counter = prev
+		}
+		counters[ecuID] = counter
+		reported := s.ECUInfo.TodayEnergy - counter.ECUInfo.TodayEnergy
+		if reported < 0 {
+			reported = s.ECUInfo.TodayEnergy
+		}
+		r.ReportedEnergyWh = float64(reported)
+
+		before := ChannelPower(prev)
+		for _, inv := range s.ArrayInfo.Inverters {
+			for _, ch := range inv.Channels() {
+				add(s, inv.ID, ch.Name, float64(ch.Power))
+				if p, ok := before[PanelID{inv.ID, ch.Name}]; ok && integrate {
+					prevRollup(inv.ID, ch.Name).EnergyWh += (p + float64(ch.Power)) / 2 * dt.Hours()
+				}
+			}
+		}
+		prevByECU[ecuID] = s
+	}
+
+	out := make([]Rollup, 0, len(rollups))
+	for _, r := range rollups {
+		r.AvgPowerW /= float64(r.Samples)
+		out = append(out, *r)
+	}
+	sortRollups(out)
+	return out
+}
+
+// MergeRollups aggregates rollups into the coarser resolution. The average
+// power is weighted by the number of samples
+func MergeRollups(rollups []Rollup, res Resolution) []Rollup {
+	merged := map[rollupKey]*Rollup{}
+	for _, r := range rollups {
+		start := res.periodStart(r.Start)
+		key := rollupKey{start.Unix(), r.EcuID, r.InverterID, r.Channel}
+		m, ok := merged[key]
+		if !ok {
+			m = &Rollup{
+				Start:      start,
+				Resolution: res,
+				EcuID:      r.EcuID,
+				InverterID: r.InverterID,
+				Channel:    r.Channel,
+				MinPowerW:  r.MinPowerW,
+				MaxPowerW:  r.MaxPowerW,
+			}
+			merged[key] = m
+		}
+		m.MinPowerW = math.Min(m.MinPowerW, r.MinPowerW)
+		m.MaxPowerW = math.Max(m.MaxPowerW, r.MaxPowerW)
+		m.AvgPowerW += r.AvgPowerW * float64(r.Samples)
+		m.Samples += r.Samples
+		m.EnergyWh += r.EnergyWh
+		m.ReportedEnergyWh += r.ReportedEnergyWh
+	}
+
+	out := make([]Rollup, 0, len(merged))
+	for _, m := range merged {
+		if m.Samples > 0 {
+			m.AvgPowerW /= float64(m.Samples)
+		}
+		out = append(out, *m)
+	}
+	sortRollups(out)
+	return out
+}
+
+func sortRollups(rollups []Rollup) {
+	sort.Slice(rollups, func(i, j int) bool {
+		a, b := rollups[i], rollups[j]
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		if a.EcuID != b.EcuID {
+			return a.EcuID < b.EcuID
+		}
+		if a.InverterID != b.InverterID {
+			return a.InverterID < b.InverterID
+		}
+		return a.Channel < b.Channel
+	})
+}
+
+// Rollups returns the stored rollups of the resolution that start in the
+// time range of q and match its ECU, inverter and channel. ECU rollups are
+// only returned when q selects neither an inverter nor a channel. Rollups
+// are created when the segment of a day is compacted, so the current day
+// is not included
+func (st *Store) Rollups(res Resolution, q Query) ([]Rollup, error) {
+	ecus := []string{q.EcuID}
+	if q.EcuID == "" {
+		var err error
+		if ecus, err = st.ECUs(); err != nil {
+			return nil, err
+		}
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	var out []Rollup
+	for _, ecuID := range ecus {
+		paths, err := filepath.Glob(filepath.Join(st.dir, ecuID, storeRollupDir, string(res)+"*"+compactedExt))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			rollups, err := readRollups(path)
+			if err != nil {
+				return nil, fmt.Errorf("could not read rollups of %s: %w", ecuID, err)
+			}
+			for _, r := range rollups {
+				if !q.From.IsZero() && r.Start.Before(q.From) || !q.To.IsZero() && !r.Start.Before(q.To) {
+					continue
+				}
+				if r.InverterID == "" && (q.InverterID != "" || q.Channel != "") {
+					continue
+				}
+				if q.InverterID != "" && r.InverterID != q.InverterID ||
+					q.Channel != "" && !strings.EqualFold(r.Channel, q.Channel) {
+					continue
+				}
+				out = append(out, r)
+			}
+		}
+	}
+	sortRollups(out)
+	return out, nil
+}
+
+// updateRollups replaces the hourly rollups of a day, and recomputes the
+// daily and monthly rollups that include it
+func (st *Store) updateRollups(ecuID, day string, snapshots []Snapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	dir := filepath.Join(st.dir, ecuID, storeRollupDir)
+	if err := os.MkdirAll(dir, storeDirPerm); err != nil {
+		return err
+	}
+	month, year := day[:7], day[:4]
+
+	// Snapshots may include the first of the next day, which only adds the
+	// energy up to midnight to the last hour of the day
+	var rollups []Rollup
+	for _, r := range RollupSnapshots(snapshots) {
+		if r.Start.Format(segmentDayFmt) == day {
+			rollups = append(rollups, r)
+		}
+	}
+
+	hourPath := filepath.Join(dir, "hour-"+month+compactedExt)
+	hours, err := replaceRollups(hourPath, rollups, func(r Rollup) bool {
+		return r.Start.Format(segmentDayFmt) == day
+	})
+	if err != nil {
+		return err
+	}
+
+	dayPath := filepath.Join(dir, "day-"+year+compactedExt)
+	days, err := replaceRollups(dayPath, MergeRollups(hours, ResolutionDay), func(r Rollup) bool {
+		return r.Start.Format("2006-01") == month
+	})
+	if err != nil {
+		return err
+	}
+
+	monthPath := filepath.Join(dir, "month"+compactedExt)
+	_, err = replaceRollups(monthPath, MergeRollups(days, ResolutionMonth), func(r Rollup) bool {
+		return r.Start.Format("2006") == year
+	})
+	return err
+}
+
+// replaceRollups replaces the rollups in the file for which replaced returns
+// true by the given rollups, and returns the new content of the file
+func replaceRollups(path string, rollups []Rollup, replaced func(Rollup) bool) ([]Rollup, error) {
+	existing, err := readRollups(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, r := range existing {
+		if !replaced(r) {
+			rollups = append(rollups, r)
+		}
+	}
+	sortRollups(rollups)
+	return rollups, writeRollups(path, rollups)
+}
+
+func readRollups(path string) ([]Rollup, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var rollups []Rollup
+	dec := json.NewDecoder(gz)
+	for {
+		var r Rollup
+		err := dec.Decode(&r)
+		if err == io.EOF {
+			return rollups, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+}
+
+// writeRollups atomically replaces a rollup file
+func writeRollups(path string, rollups []Rollup) error {
+	return writeCompressed(path, func(enc *json.Encoder) error {
+		for _, r := range rollups {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// prune removes compacted raw segments of days more than the retention
+// period before the current day. Their data remains available as rollups
+func (st *Store) prune(ecuID, current string) error {
+	if st.Retention <= 0 {
+		return nil
+	}
+	now, err := time.Parse(segmentDayFmt, current)
+	if err != nil {
+		return err
+	}
+	oldest := now.Add(-st.Retention).Format(segmentDayFmt)
+
+	dir := filepath.Join(st.dir, ecuID, storeRawDir)
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+compactedExt))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if strings.TrimSuffix(filepath.Base(path), compactedExt) < oldest {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package ecur
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rollupSnapshot returns a snapshot with the given ECU timestamp, power on
+// channel A of the first inverter and ECU power and energy counter
+func rollupSnapshot(ts time.Time, channelPower, ecuPower, todayEnergy int) Snapshot {
+	s := storeSnapshot(ts, channelPower)
+	s.ECUInfo.LastPower = ecuPower
+	s.ECUInfo.TodayEnergy = todayEnergy
+	return s
+}
+
+func findRollup(t *testing.T, rollups []Rollup, start time.Time, inverterID, channel string) Rollup {
+	for _, r := range rollups {
+		if r.Start.Equal(start) && r.InverterID == inverterID && r.Channel == channel {
+			return r
+		}
+	}
+	t.Fatalf("no rollup for %s %s/%s", start, inverterID, channel)
+	return Rollup{}
+}
+
+func TestRollupSnapshots(t *testing.T) {
+	noon := time.Date(2021, 10, 20, 12, 0, 0, 0, time.UTC)
+	rollups := RollupSnapshots([]Snapshot{
+		rollupSnapshot(noon.Add(30*time.Minute), 200, 400, 1100),
+		rollupSnapshot(noon, 100, 200, 1000),
+		rollupSnapshot(noon.Add(time.Hour), 100, 200, 1150),
+	})
+
+	a := findRollup(t, rollups, noon, "801000030000", "A")
+	require.Equal(t, 2, a.Samples)
+	require.Equal(t, 100.0, a.MinPowerW)
+	require.Equal(t, 200.0, a.MaxPowerW)
+	require.Equal(t, 150.0, a.AvgPowerW)
+	// Energy of both half hours belongs to the hour they start in
+	require.InDelta(t, 150, a.EnergyWh, 0.001)
+	require.Equal(t, ResolutionHour, a.Resolution)
+
+	ecu := findRollup(t, rollups, noon, "", "")
+	require.InDelta(t, 300, ecu.EnergyWh, 0.001)
+	require.Equal(t, 1100.0, ecu.ReportedEnergyWh)
+
+	ecu = findRollup(t, rollups, noon.Add(time.Hour), "", "")
+	require.Equal(t, 0.0, ecu.EnergyWh)
+	require.Equal(t, 50.0, ecu.ReportedEnergyWh)
+
+	day := MergeRollups(rollups, ResolutionDay)
+	a = findRollup(t, day, noon.Add(-12*time.Hour), "801000030000", "A")
+	require.Equal(t, 3, a.Samples)
+	require.InDelta(t, 133.333, a.AvgPowerW, 0.001)
+	require.InDelta(t, 150, a.EnergyWh, 0.001)
+	ecu = findRollup(t, day, noon.Add(-12*time.Hour), "", "")
+	require.Equal(t, 1150.0, ecu.ReportedEnergyWh)
+}
+
+func TestStoreRollupsAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	st, err := OpenStore(dir)
+	require.NoError(t, err)
+	st.Retention = 24 * time.Hour
+
+	day := time.Date(2021, 10, 18, 12, 0, 0, 0, time.UTC)
+	for d := 0; d < 3; d++ {
+		for i := 0; i < 3; i++ {
+			ts := day.Add(time.Duration(d)*24*time.Hour + time.Duration(i)*5*time.Minute)
+			require.NoError(t, st.Write(rollupSnapshot(ts, 100, 200, 1000)))
+		}
+	}
+
+	// The first two days are rolled up, the last day is still raw
+	hours, err := st.Rollups(ResolutionHour, Query{})
+	require.NoError(t, err)
+	require.Len(t, hours, 2*(1+8))
+	days, err := st.Rollups(ResolutionDay, Query{InverterID: "801000030000", Channel: "A"})
+	require.NoError(t, err)
+	require.Len(t, days, 2)
+	require.InDelta(t, 100.0/6, days[0].EnergyWh, 0.001)
+	months, err := st.Rollups(ResolutionMonth, Query{From: day.AddDate(0, 0, -18)})
+	require.NoError(t, err)
+	require.Len(t, months, 1+8)
+	require.Equal(t, 6, months[0].Samples)
+
+	// Raw data before the retention period is removed
+	raw := filepath.Join(dir, "216000011111", "raw")
+	_, err = os.Stat(filepath.Join(raw, "2021-10-18.jsonl.gz"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(raw, "2021-10-19.jsonl.gz"))
+	require.NoError(t, err)
+}
+
+func TestStoreRollupsAcrossMidnight(t *testing.T) {
+	st, err := OpenStore(t.TempDir())
+	require.NoError(t, err)
+
+	evening := time.Date(2021, 10, 18, 23, 50, 0, 0, time.UTC)
+	require.NoError(t, st.Write(rollupSnapshot(evening, 300, 600, 5000)))
+	require.NoError(t, st.Write(rollupSnapshot(evening.Add(20*time.Minute), 300, 600, 100)))
+
+	// The energy up to the first snapshot after midnight belongs to the
+	// last hour of the day
+	hours, err := st.Rollups(ResolutionHour, Query{})
+	require.NoError(t, err)
+	require.Len(t, hours, 1+8)
+	require.InDelta(t, 200.0, findRollup(t, hours, evening.Truncate(time.Hour), "", "").EnergyWh, 0.001)
+	require.InDelta(t, 100.0, findRollup(t, hours, evening.Truncate(time.Hour), "801000030000", "A").EnergyWh, 0.001)
+	require.Equal(t, 1, hours[0].Samples)
+}
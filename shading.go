@@ -0,0 +1,215 @@
+package ecur
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ShadingOptions configures DetectShading
+type ShadingOptions struct {
+	// SlotSize is the resolution of the time of day profile
+	SlotSize time.Duration
+	// MinPower skips samples where the average channel power of the array is
+	// below this value (in W)
+	MinPower float64
+	// DipThreshold is the fraction of the channel's normal ratio to its
+	// siblings below which a sample counts as a dip
+	DipThreshold float64
+	// Recurrence is the fraction of samples in a slot that need to be a dip
+	// for the slot to be reported
+	Recurrence float64
+	// MinDays is the minimum number of different days with samples in a slot
+	MinDays int
+}
+
+func DefaultShadingOptions() ShadingOptions {
+	return ShadingOptions{
+		SlotSize:     30 * time.Minute,
+		MinPower:     20,
+		DipThreshold: 0.7,
+		Recurrence:   0.6,
+		MinDays:      3,
+	}
+}
+
+// ShadingWindow is a recurring time of day window in which a channel produces
+// less than its siblings. Start and End are offsets from midnight
+type ShadingWindow struct {
+	Start time.Duration
+	End   time.Duration
+	Depth float64 // average relative loss compared to the channel's normal ratio
+	Days  int     // number of days with samples in the window
+}
+
+func (w ShadingWindow) String() string {
+	return fmt.Sprintf("%s-%s", formatTimeOfDay(w.Start), formatTimeOfDay(w.End))
+}
+
+// MonthlyShading groups the shading windows of a channel for a single month
+type MonthlyShading struct {
+	Month   string // e.g. 2021-06
+	Windows []ShadingWindow
+}
+
+// ShadingReport lists the shading windows per month for a single channel
+type ShadingReport struct {
+	InverterID string
+	Channel    string
+	Months     []MonthlyShading
+}
+
+type shadingSlot struct {
+	ratios []float64
+	days   map[string]bool
+}
+
+// DetectShading builds a time of day profile per channel and month from the
+// ratio between the channel and its siblings on the same inverter. Slots in
+// which the ratio recurrently drops well below the channel's normal ratio
+// indicate partial shading that does not affect the sibling channels
+func DetectShading(snapshots []Snapshot, opts ShadingOptions) ([]ShadingReport, error) {
+	if opts.SlotSize <= 0 {
+		return nil, fmt.Errorf("invalid slot size %s, must be positive", opts.SlotSize)
+	}
+
+	// channel -> month -> slot -> ratios
+	profiles := map[channelKey]map[string]map[int]*shadingSlot{}
+
+	for _, s := range snapshots {
+		ts := s.ArrayInfo.Timestamp
+		month := ts.Format("2006-01")
+		day := ts.Format("2006-01-02")
+		midnight := time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, ts.Location())
+		slot := int(ts.Sub(midnight) / opts.SlotSize)
+
+		for _, inv := range s.ArrayInfo.Inverters {
+			if !inv.Online {
+				continue
+			}
+			channels := inv.Channels()
+			total := inv.TotalPower()
+			if float64(total)/float64(len(channels)) < opts.MinPower {
+				continue
+			}
+			for _, ch := range channels {
+				siblings := float64(total-ch.Power) / float64(len(channels)-1)
+				if siblings <= 0 {
+					continue
+				}
+
+				key := channelKey{inv.ID, ch.Name}
+				if profiles[key] == nil {
+					profiles[key] = map[string]map[int]*shadingSlot{}
+				}
+				if profiles[key][month] == nil {
+					profiles[key][month] = map[int]*shadingSlot{}
+				}
+				sl, ok := profiles[key][month][slot]
+				if !ok {
+					sl = &shadingSlot{days: map[string]bool{}}
+					profiles[key][month][slot] = sl
+				}
+				sl.ratios = append(sl.ratios, float64(ch.Power)/siblings)
+				sl.days[day] = true
+			}
+		}
+	}
+
+	var reports []ShadingReport
+	for key, months := range profiles {
+		report := ShadingReport{InverterID: key.inverterID, Channel: key.channel}
+		for month, slots := range months {
+			if windows := shadingWindows(slots, opts); len(windows) > 0 {
+				report.Months = append(report.Months, MonthlyShading{Month: month, Windows: windows})
+			}
+		}
+		sort.Slice(report.Months, func(i, j int) bool { return report.Months[i].Month < report.Months[j].Month })
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].InverterID != reports[j].InverterID {
+			return reports[i].InverterID < reports[j].InverterID
+		}
+		return reports[i].Channel < reports[j].Channel
+	})
+	return reports, nil
+}
+
+// shadingWindows finds the dip slots of a single channel and month, and
+// merges adjacent slots into windows
+func shadingWindows(slots map[int]*shadingSlot, opts ShadingOptions) []ShadingWindow {
+	// The normal ratio is the median of the slot averages
+	var averages []float64
+	for _, sl := range slots {
+		averages = append(averages, mean(sl.ratios))
+	}
+	baseline := median(averages)
+	if baseline <= 0 {
+		return nil
+	}
+
+	var indices []int
+	for i := range slots {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+
+	var windows []ShadingWindow
+	var current *ShadingWindow
+	var depths []float64
+	closeWindow := func() {
+		if current != nil {
+			current.Depth = mean(depths)
+			windows = append(windows, *current)
+		}
+		current, depths = nil, nil
+	}
+
+	for _, i := range indices {
+		sl := slots[i]
+		dips := 0
+		for _, r := range sl.ratios {
+			if r < baseline*opts.DipThreshold {
+				dips++
+			}
+		}
+		isDip := len(sl.days) >= opts.MinDays && float64(dips)/float64(len(sl.ratios)) >= opts.Recurrence
+		if !isDip {
+			closeWindow()
+			continue
+		}
+
+		start := time.Duration(i) * opts.SlotSize
+		if current == nil || current.End != start {
+			closeWindow()
+			current = &ShadingWindow{Start: start}
+		}
+		current.End = start + opts.SlotSize
+		if len(sl.days) > current.Days {
+			current.Days = len(sl.days)
+		}
+		depths = append(depths, 1-mean(sl.ratios)/baseline)
+	}
+	closeWindow()
+
+	return windows
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func formatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,68 @@
+package ecur
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// shadedSnapshots returns samples every 15 minutes between 08:00 and 18:00
+// for the given number of days, with channel B of the first inverter shaded
+// between 10:00 and 11:00
+func shadedSnapshots(days int) []Snapshot {
+	var snapshots []Snapshot
+	start := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	for d := 0; d < days; d++ {
+		for m := 0; m < 10*60; m += 15 {
+			ts := start.AddDate(0, 0, d).Add(time.Duration(m) * time.Minute)
+			s := testSnapshot(ts)
+			s.ArrayInfo.Timestamp = ts
+			for i := range s.ArrayInfo.Inverters {
+				inv := &s.ArrayInfo.Inverters[i]
+				inv.PowerA, inv.PowerB, inv.PowerC, inv.PowerD = 200, 200, 200, 200
+			}
+			if ts.Hour() == 10 {
+				s.ArrayInfo.Inverters[0].PowerB = 60
+			}
+			snapshots = append(snapshots, s)
+		}
+	}
+	return snapshots
+}
+
+func TestDetectShading(t *testing.T) {
+	reports, err := DetectShading(shadedSnapshots(5), DefaultShadingOptions())
+	require.NoError(t, err)
+	require.Len(t, reports, 8)
+
+	for _, r := range reports {
+		if r.InverterID == "801000030000" && r.Channel == "B" {
+			require.Len(t, r.Months, 1)
+			require.Equal(t, "2021-06", r.Months[0].Month)
+			require.Len(t, r.Months[0].Windows, 1)
+			w := r.Months[0].Windows[0]
+			require.Equal(t, "10:00-11:00", w.String())
+			require.Equal(t, 5, w.Days)
+			require.InDelta(t, 0.7, w.Depth, 0.01)
+			continue
+		}
+		require.Empty(t, r.Months, "%s/%s", r.InverterID, r.Channel)
+	}
+}
+
+func TestDetectShadingNeedsRecurrence(t *testing.T) {
+	// A dip on only two days is not reported
+	reports, err := DetectShading(shadedSnapshots(2), DefaultShadingOptions())
+	require.NoError(t, err)
+	for _, r := range reports {
+		require.Empty(t, r.Months)
+	}
+}
+
+func TestDetectShadingSlotSize(t *testing.T) {
+	opts := DefaultShadingOptions()
+	opts.SlotSize = 0
+	_, err := DetectShading(shadedSnapshots(5), opts)
+	require.Error(t, err)
+}
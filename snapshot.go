@@ -0,0 +1,73 @@
+package ecur
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Snapshot is a single, complete reading of the ECU-R together with the
+// (host) time at which it was collected
+type Snapshot struct {
+	ECUResponse
+	CollectedAt time.Time
+
+	// ClockOffset is the ECU timestamp minus the host time of collection.
+	// Besides clock drift it includes the age of the ECU data (up to the ECU
+	// refresh interval of ~5 minutes)
+	ClockOffset time.Duration
+	// StaleFor is how long the ECU has been serving the same timestamp, as
+	// observed by the Collector. Stale is set once it exceeds the threshold
+	StaleFor time.Duration
+	Stale    bool
+}
+
+// NewSnapshot wraps an ECUResponse into a Snapshot collected at the given time
+func NewSnapshot(resp ECUResponse, collectedAt time.Time) Snapshot {
+	s := Snapshot{
+		ECUResponse: resp,
+		CollectedAt: collectedAt,
+	}
+	if !resp.ArrayInfo.Timestamp.IsZero() {
+		s.ClockOffset = resp.ArrayInfo.Timestamp.Sub(collectedAt)
+	}
+	return s
+}
+
+// Inverter returns the inverter with the given ID from the snapshot
+func (s Snapshot) Inverter(id string) (InverterInfo, bool) {
+	for _, inv := range s.ArrayInfo.Inverters {
+		if inv.ID == id {
+			return inv, true
+		}
+	}
+	return InverterInfo{}, false
+}
+
+// ReadSnapshots decodes a stream of JSON encoded snapshots, such as the
+// output of repeated 'aps get --json' runs. Both the versioned JSONDocument
+// and plain Snapshot or ECUResponse values are accepted. Without collection
+// time, the ECU timestamp is used instead
+func ReadSnapshots(r io.Reader) ([]Snapshot, error) {
+	var snapshots []Snapshot
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return snapshots, nil
+		}
+		if err != nil {
+			return snapshots, fmt.Errorf("could not decode snapshot %d: %w", len(snapshots)+1, err)
+		}
+		s, err := decodeSnapshot(raw)
+		if err != nil {
+			return snapshots, fmt.Errorf("could not decode snapshot %d: %w", len(snapshots)+1, err)
+		}
+		if s.CollectedAt.IsZero() {
+			s.CollectedAt = s.ArrayInfo.Timestamp
+		}
+		snapshots = append(snapshots, s)
+	}
+}
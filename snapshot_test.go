@@ -0,0 +1,27 @@
+package ecur
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSnapshots(t *testing.T) {
+	input := `{"ECUInfo":{"EcuID":"216000011111"},"ArrayInfo":{"Timestamp":"2021-10-28T10:00:00Z","Inverters":[{"ID":"801000030000","Online":true}]}}
+{"ECUInfo":{"EcuID":"216000011111"},"ArrayInfo":{"Timestamp":"2021-10-28T10:05:00Z"},"CollectedAt":"2021-10-28T10:06:00Z"}`
+
+	snapshots, err := ReadSnapshots(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	require.Equal(t, time.Date(2021, 10, 28, 10, 0, 0, 0, time.UTC), snapshots[0].CollectedAt)
+	require.Equal(t, time.Date(2021, 10, 28, 10, 6, 0, 0, time.UTC), snapshots[1].CollectedAt)
+
+	inv, ok := snapshots[0].Inverter("801000030000")
+	require.True(t, ok)
+	require.True(t, inv.Online)
+
+	_, err = ReadSnapshots(strings.NewReader(`{"ECUInfo":`))
+	require.Error(t, err)
+}
@@ -0,0 +1,502 @@
+package ecur
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	storeRawDir     = "raw"
+	segmentExt      = ".jsonl"
+	compactedExt    = ".jsonl.gz"
+	segmentDayFmt   = "2006-01-02"
+	maxSegmentLine  = 1 << 20
+	storeFilePerm   = 0o644
+	storeDirPerm    = 0o755
+	storeTempSuffix = ".tmp"
+)
+
+// Store is an append-only history of snapshots on disk, without external
+// dependencies. Snapshots are stored per ECU-R in one segment file per ECU
+// day, as JSON lines in the format of JSONDocument:
+//
+//	<dir>/<ecu id>/raw/2021-10-20.jsonl      segment of the current day
+//	<dir>/<ecu id>/raw/2021-10-19.jsonl.gz   compacted segment
+//
+// Segments of earlier days are compacted: sorted, without duplicate ECU
+// timestamps, and gzip compressed. Compaction also creates hourly, daily and
+// monthly rollups of the day, and removes raw segments older than the
+// retention period:
+//
+//	<dir>/<ecu id>/rollup/hour-2021-10.jsonl.gz
+//	<dir>/<ecu id>/rollup/day-2021.jsonl.gz
+//	<dir>/<ecu id>/rollup/month.jsonl.gz
+//
+// Store implements Sink, so a Collector writes every snapshot to it once it
+// is added with AddSink
+type Store struct {
+	dir string
+
+	// Retention is the period raw snapshots are kept for, counted back from
+	// the most recent day. Zero keeps them forever
+	Retention time.Duration
+
+	// OnGap is called, when set, if the first snapshot written for an ECU-R
+	// after opening the store leaves a gap after the last stored snapshot,
+	// i.e. with the downtime before a restart
+	OnGap func(Gap)
+	// GapThreshold is the threshold for OnGap, DefaultGapThreshold when zero
+	GapThreshold time.Duration
+
+	mu sync.RWMutex
+	// last ECU timestamp written, per ECU ID
+	last map[string]time.Time
+}
+
+// OpenStore opens the store in dir, creating the directory if needed
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, storeDirPerm); err != nil {
+		return nil, fmt.Errorf("could not open store: %w", err)
+	}
+	return &Store{dir: dir, last: map[string]time.Time{}}, nil
+}
+
+// Dir returns the directory of the store
+func (st *Store) Dir() string {
+	return st.dir
+}
+
+// Write appends the snapshot to the segment of its ECU day. Snapshots with
+// the ECU timestamp of the previous write are skipped, since the ECU-R only
+// refreshes its data every 5 minutes. The first write of a new day compacts
+// the segments of earlier days
+func (st *Store) Write(s Snapshot) error {
+	ecuID, ts := s.ECUInfo.EcuID, s.ArrayInfo.Timestamp
+	if ecuID == "" || ts.IsZero() {
+		return fmt.Errorf("could not store snapshot: %w", ErrMalformedBody)
+	}
+
+	// Reported once the snapshot is stored, without holding the lock
+	var gap *Gap
+	defer func() {
+		if gap != nil {
+			st.OnGap(*gap)
+		}
+	}()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	prev := st.last[ecuID]
+	if prev.Equal(ts) {
+		return nil
+	}
+	var pending *Gap
+	if prev.IsZero() && st.OnGap != nil {
+		last, ok, err := st.lastStored(ecuID, ts)
+		if err != nil {
+			return fmt.Errorf("could not store snapshot: %w", err)
+		}
+		if ok && isGap(last, s, st.GapThreshold) {
+			pending = &Gap{EcuID: ecuID, From: last.ArrayInfo.Timestamp, To: ts}
+		}
+	}
+
+	line, err := json.Marshal(NewJSONDocument(s, false))
+	if err != nil {
+		return fmt.Errorf("could not store snapshot: %w", err)
+	}
+	dir := filepath.Join(st.dir, ecuID, storeRawDir)
+	if err := os.MkdirAll(dir, storeDirPerm); err != nil {
+		return fmt.Errorf("could not store snapshot: %w", err)
+	}
+	path := filepath.Join(dir, ts.Format(segmentDayFmt)+segmentExt)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, storeFilePerm)
+	if err != nil {
+		return fmt.Errorf("could not store snapshot: %w", err)
+	}
+	// A line torn by a power failure is ended first, so that it does not
+	// take this snapshot with it
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	// A single write per line, so that readers never see half a snapshot
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("could not store snapshot: %w", err)
+	}
+	st.last[ecuID] = ts
+	gap = pending
+
+	if !prev.IsZero() && !sameDay(prev, ts) {
+		return st.compactECU(ecuID, ts.Format(segmentDayFmt))
+	}
+	return nil
+}
+
+// Compact compacts the segments of all days before the most recent day of
+// every ECU-R
+func (st *Store) Compact() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	ecus, err := st.ecuIDs()
+	if err != nil {
+		return err
+	}
+	for _, ecuID := range ecus {
+		days, err := st.segmentDays(ecuID)
+		if err != nil {
+			return err
+		}
+		if len(days) == 0 {
+			continue
+		}
+		if err := st.compactECU(ecuID, days[len(days)-1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compactECU compacts all uncompacted segments of days before current
+func (st *Store) compactECU(ecuID, current string) error {
+	dir := filepath.Join(st.dir, ecuID, storeRawDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not compact store: %w", err)
+	}
+	for _, e := range entries {
+		day := strings.TrimSuffix(e.Name(), segmentExt)
+		if !strings.HasSuffix(e.Name(), segmentExt) || day >= current {
+			continue
+		}
+		if err := st.compactSegment(ecuID, day); err != nil {
+			return fmt.Errorf("could not compact segment %s of %s: %w", day, ecuID, err)
+		}
+	}
+	if err := st.prune(ecuID, current); err != nil {
+		return fmt.Errorf("could not prune store: %w", err)
+	}
+	return nil
+}
+
+// compactSegment merges a plain segment into the compacted segment of the
+// same day, which may already exist when late data was appended, and
+// updates the rollups of the day
+func (st *Store) compactSegment(ecuID, day string) error {
+	dir := filepath.Join(st.dir, ecuID, storeRawDir)
+	plain := filepath.Join(dir, day+segmentExt)
+	compacted := filepath.Join(dir, day+compactedExt)
+
+	snapshots, err := readSegment(plain)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(compacted); err == nil {
+		existing, err := readSegment(compacted)
+		if err != nil {
+			return err
+		}
+		snapshots = append(existing, snapshots...)
+	}
+	snapshots = dedupeSnapshots(snapshots)
+	if err := writeSegment(compacted, snapshots); err != nil {
+		return err
+	}
+	// The first snapshot of the next day closes the energy up to midnight
+	next, err := st.firstOfNextDay(ecuID, day)
+	if err != nil {
+		return err
+	}
+	if err := st.updateRollups(ecuID, day, append(snapshots, next...)); err != nil {
+		return err
+	}
+	return os.Remove(plain)
+}
+
+// firstOfNextDay returns the first stored snapshot of the day after day, if
+// there is one
+func (st *Store) firstOfNextDay(ecuID, day string) ([]Snapshot, error) {
+	start, err := time.Parse(segmentDayFmt, day)
+	if err != nil {
+		return nil, err
+	}
+	next := start.AddDate(0, 0, 1).Format(segmentDayFmt)
+
+	var first []Snapshot
+	dir := filepath.Join(st.dir, ecuID, storeRawDir)
+	for _, ext := range []string{compactedExt, segmentExt} {
+		segment, err := readSegment(filepath.Join(dir, next+ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range segment {
+			if len(first) == 0 || s.ArrayInfo.Timestamp.Before(first[0].ArrayInfo.Timestamp) {
+				first = []Snapshot{s}
+			}
+		}
+	}
+	return first, nil
+}
+
+// Snapshots returns the stored snapshots of the ECU-R with an ECU timestamp
+// in [from, to), sorted by time. A zero from or to leaves the range open
+func (st *Store) Snapshots(ecuID string, from, to time.Time) ([]Snapshot, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	days, err := st.segmentDays(ecuID)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	dir := filepath.Join(st.dir, ecuID, storeRawDir)
+	for _, day := range days {
+		if !dayInRange(day, from, to) {
+			continue
+		}
+		for _, ext := range []string{compactedExt, segmentExt} {
+			segment, err := readSegment(filepath.Join(dir, day+ext))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("could not read segment %s of %s: %w", day, ecuID, err)
+			}
+			for _, s := range segment {
+				ts := s.ArrayInfo.Timestamp
+				if (from.IsZero() || !ts.Before(from)) && (to.IsZero() || ts.Before(to)) {
+					snapshots = append(snapshots, s)
+				}
+			}
+		}
+	}
+	return dedupeSnapshots(snapshots), nil
+}
+
+// Query selects stored channel samples. Empty fields match everything, and
+// a zero From or To leaves the time range open. To is exclusive
+type Query struct {
+	EcuID      string
+	InverterID string
+	Channel    string
+	From       time.Time
+	To         time.Time
+}
+
+// Sample is the power of a single channel at an ECU timestamp
+type Sample struct {
+	Time       time.Time `json:"time"`
+	EcuID      string    `json:"ecu_id"`
+	InverterID string    `json:"inverter_id"`
+	Channel    string    `json:"channel"`
+	PowerW     float64   `json:"power_w"`
+}
+
+// Query returns the channel samples matching q, sorted by time
+func (st *Store) Query(q Query) ([]Sample, error) {
+	ecus := []string{q.EcuID}
+	if q.EcuID == "" {
+		var err error
+		if ecus, err = st.ECUs(); err != nil {
+			return nil, err
+		}
+	}
+
+	var samples []Sample
+	for _, ecuID := range ecus {
+		snapshots, err := st.Snapshots(ecuID, q.From, q.To)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range snapshots {
+			for _, inv := range s.ArrayInfo.Inverters {
+				if q.InverterID != "" && inv.ID != q.InverterID {
+					continue
+				}
+				for _, ch := range inv.Channels() {
+					if q.Channel != "" && !strings.EqualFold(ch.Name, q.Channel) {
+						continue
+					}
+					samples = append(samples, Sample{
+						Time:       s.ArrayInfo.Timestamp,
+						EcuID:      ecuID,
+						InverterID: inv.ID,
+						Channel:    ch.Name,
+						PowerW:     float64(ch.Power),
+					})
+				}
+			}
+		}
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+	return samples, nil
+}
+
+// ECUs returns the IDs of the ECU-Rs with stored data
+func (st *Store) ECUs() ([]string, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.ecuIDs()
+}
+
+func (st *Store) ecuIDs() ([]string, error) {
+	entries, err := os.ReadDir(st.dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read store: %w", err)
+	}
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() {
+			ids = append(ids, e.Name())
+		}
+	}
+	return ids, nil
+}
+
+// segmentDays returns the days with a segment, plain or compacted, in order
+func (st *Store) segmentDays(ecuID string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(st.dir, ecuID, storeRawDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read store: %w", err)
+	}
+	seen := map[string]bool{}
+	var days []string
+	for _, e := range entries {
+		name := e.Name()
+		day := strings.TrimSuffix(strings.TrimSuffix(name, compactedExt), segmentExt)
+		if day == name || seen[day] {
+			continue
+		}
+		seen[day] = true
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// dayInRange reports whether a segment day may hold timestamps in [from, to).
+// Days are ECU local, so a day of margin covers every time zone
+func dayInRange(day string, from, to time.Time) bool {
+	start, err := time.Parse(segmentDayFmt, day)
+	if err != nil {
+		return false
+	}
+	if !from.IsZero() && start.Add(48*time.Hour).Before(from) {
+		return false
+	}
+	if !to.IsZero() && !start.Add(-24*time.Hour).Before(to) {
+		return false
+	}
+	return true
+}
+
+// readSegment reads a plain or gzip compressed segment. Lines that can not
+// be decoded, such as a line cut short by a power failure, are skipped
+func readSegment(path string) ([]Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var snapshots []Snapshot
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxSegmentLine)
+	for scanner.Scan() {
+		s, err := decodeSnapshot(scanner.Bytes())
+		if err != nil || s.ArrayInfo.Timestamp.IsZero() {
+			continue
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, scanner.Err()
+}
+
+// writeSegment atomically replaces a compacted segment
+func writeSegment(path string, snapshots []Snapshot) error {
+	return writeCompressed(path, func(enc *json.Encoder) error {
+		for _, s := range snapshots {
+			if err := enc.Encode(NewJSONDocument(s, false)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeCompressed atomically replaces a gzip compressed file of JSON lines
+func writeCompressed(path string, encode func(*json.Encoder) error) error {
+	tmp := path + storeTempSuffix
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, storeFilePerm)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	err = encode(json.NewEncoder(gz))
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// dedupeSnapshots sorts snapshots by ECU timestamp and keeps the first
+// snapshot of every timestamp
+func dedupeSnapshots(snapshots []Snapshot) []Snapshot {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].ArrayInfo.Timestamp.Before(snapshots[j].ArrayInfo.Timestamp)
+	})
+	var out []Snapshot
+	for _, s := range snapshots {
+		if n := len(out); n > 0 && out[n-1].ArrayInfo.Timestamp.Equal(s.ArrayInfo.Timestamp) {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package ecur
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// storeSnapshot returns a snapshot with the given ECU timestamp and power on
+// channel A of the first inverter
+func storeSnapshot(ts time.Time, power int) Snapshot {
+	s := testSnapshot(ts)
+	s.ArrayInfo.Timestamp = ts
+	s.ArrayInfo.Inverters[0].PowerA = power
+	return s
+}
+
+func TestStoreWriteAndQuery(t *testing.T) {
+	dir := t.TempDir()
+	st, err := OpenStore(dir)
+	require.NoError(t, err)
+
+	day := time.Date(2021, 10, 20, 12, 0, 0, 0, time.UTC)
+	for i, p := range []int{100, 110, 120} {
+		require.NoError(t, st.Write(storeSnapshot(day.Add(time.Duration(i)*5*time.Minute), p)))
+	}
+	// Unchanged ECU timestamps are written once
+	require.NoError(t, st.Write(storeSnapshot(day.Add(10*time.Minute), 120)))
+
+	segment := filepath.Join(dir, "216000011111", "raw", "2021-10-20.jsonl")
+	snapshots, err := readSegment(segment)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 3)
+
+	samples, err := st.Query(Query{InverterID: "801000030000", Channel: "a", From: day.Add(time.Minute)})
+	require.NoError(t, err)
+	require.Equal(t, []Sample{
+		{Time: day.Add(5 * time.Minute), EcuID: "216000011111", InverterID: "801000030000", Channel: "A", PowerW: 110},
+		{Time: day.Add(10 * time.Minute), EcuID: "216000011111", InverterID: "801000030000", Channel: "A", PowerW: 120},
+	}, normalizeSamples(samples))
+
+	// Two inverters with four channels each
+	samples, err = st.Query(Query{EcuID: "216000011111", To: day.Add(time.Minute)})
+	require.NoError(t, err)
+	require.Len(t, samples, 8)
+
+	samples, err = st.Query(Query{EcuID: "216000099999"})
+	require.NoError(t, err)
+	require.Empty(t, samples)
+}
+
+func TestStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	st, err := OpenStore(dir)
+	require.NoError(t, err)
+	raw := filepath.Join(dir, "216000011111", "raw")
+
+	day := time.Date(2021, 10, 20, 23, 50, 0, 0, time.UTC)
+	require.NoError(t, st.Write(storeSnapshot(day, 100)))
+	require.NoError(t, st.Write(storeSnapshot(day.Add(5*time.Minute), 100)))
+
+	// A torn line, as left behind by a power failure, is skipped, and does
+	// not take the next snapshot with it
+	f, err := os.OpenFile(filepath.Join(raw, "2021-10-20.jsonl"), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	f.WriteString(`{"schema_version":1,"timesta`)
+	f.Close()
+	require.NoError(t, st.Write(storeSnapshot(day.Add(7*time.Minute), 100)))
+
+	// The first snapshot of the next day compacts the previous day
+	require.NoError(t, st.Write(storeSnapshot(day.Add(10*time.Minute), 0)))
+	_, err = os.Stat(filepath.Join(raw, "2021-10-20.jsonl"))
+	require.True(t, os.IsNotExist(err))
+	compacted, err := readSegment(filepath.Join(raw, "2021-10-20.jsonl.gz"))
+	require.NoError(t, err)
+	require.Len(t, compacted, 3)
+
+	// Late data for a compacted day is merged by the next compaction
+	st2, err := OpenStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, st2.Write(storeSnapshot(day.Add(-5*time.Minute), 90)))
+	require.NoError(t, st2.Write(storeSnapshot(day, 100)))
+	require.NoError(t, st2.Compact())
+	compacted, err = readSegment(filepath.Join(raw, "2021-10-20.jsonl.gz"))
+	require.NoError(t, err)
+	require.Len(t, compacted, 4)
+
+	snapshots, err := st2.Snapshots("216000011111", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, snapshots, 5)
+	require.True(t, snapshots[0].ArrayInfo.Timestamp.Equal(day.Add(-5*time.Minute)))
+}
+
+func TestCollectorWritesStore(t *testing.T) {
+	st, err := OpenStore(t.TempDir())
+	require.NoError(t, err)
+
+	c := NewCollector(&fakeSource{responses: []ECUResponse{testSnapshot(time.Now()).ECUResponse}}, time.Minute)
+	c.AddSink(st)
+	_, err = c.Poll()
+	require.NoError(t, err)
+
+	ecus, err := st.ECUs()
+	require.NoError(t, err)
+	require.Equal(t, []string{"216000011111"}, ecus)
+}
+
+// normalizeSamples drops the monotonic clock and location from sample times
+func normalizeSamples(samples []Sample) []Sample {
+	for i := range samples {
+		samples[i].Time = samples[i].Time.UTC()
+	}
+	return samples
+}
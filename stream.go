@@ -0,0 +1,165 @@
+package ecur
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// streamBuffer is the number of updates buffered per stream client
+	streamBuffer = 64
+	// streamKeepAlive is the interval of keep-alives on idle streams, which
+	// stop proxies from closing the connection
+	streamKeepAlive = 30 * time.Second
+)
+
+// StreamMessage is a single message on /api/v1/stream. Type is "snapshot",
+// with a JSONDocument as Data, or "event", with a JSONEvent as Data
+type StreamMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+func NewStreamMessage(u Update) StreamMessage {
+	if u.Snapshot != nil {
+		return StreamMessage{Type: "snapshot", Data: NewJSONDocument(*u.Snapshot, false)}
+	}
+	return StreamMessage{Type: "event", Data: NewJSONEvent(*u.Event)}
+}
+
+// serveStream pushes the latest snapshots, followed by every new snapshot and
+// event, as Server-Sent Events or, for WebSocket upgrade requests, as
+// WebSocket text messages. The ecu query parameter limits the stream to a
+// single ECU-R
+func (h *apiHandler) serveStream(w http.ResponseWriter, r *http.Request) {
+	collectors := h.collectors
+	if id := r.URL.Query().Get("ecu"); id != "" {
+		c, _, ok := h.find(id)
+		if !ok {
+			apiError(w, http.StatusNotFound, fmt.Sprintf("unknown ECU-R %q", id))
+			return
+		}
+		collectors = []*Collector{c}
+	}
+
+	updates := make(chan Update, streamBuffer)
+	var initial []Update
+	for _, c := range collectors {
+		defer c.Subscribe(updates)()
+		if s, ok := c.Latest(); ok {
+			initial = append(initial, Update{Snapshot: &s})
+		}
+	}
+
+	if isWebSocket(r) {
+		serveWebSocketStream(w, r, initial, updates)
+		return
+	}
+	serveSSEStream(w, r, initial, updates)
+}
+
+func serveSSEStream(w http.ResponseWriter, r *http.Request, initial []Update, updates <-chan Update) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apiError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	send := func(u Update) error {
+		msg := NewStreamMessage(u)
+		data, err := json.Marshal(msg.Data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	for _, u := range initial {
+		if send(u) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case u := <-updates:
+			if send(u) != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func serveWebSocketStream(w http.ResponseWriter, r *http.Request, initial []Update, updates <-chan Update) {
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Answer pings and close frames; anything else from the client is ignored
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			opcode, payload, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case wsClose:
+				conn.WriteMessage(wsClose, nil)
+				return
+			case wsPing:
+				conn.WriteMessage(wsPong, payload)
+			}
+		}
+	}()
+
+	send := func(u Update) error {
+		data, err := json.Marshal(NewStreamMessage(u))
+		if err != nil {
+			return err
+		}
+		return conn.WriteMessage(wsText, data)
+	}
+	for _, u := range initial {
+		if send(u) != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case u := <-updates:
+			if send(u) != nil {
+				return
+			}
+		case <-ticker.C:
+			if conn.WriteMessage(wsPing, nil) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ecur
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectorSubscribe(t *testing.T) {
+	first := testSnapshot(time.Now()).ECUResponse
+	second := testSnapshot(time.Now()).ECUResponse
+	second.ArrayInfo.Timestamp = first.ArrayInfo.Timestamp.Add(5 * time.Minute)
+	second.ArrayInfo.Inverters[1].Online = false
+
+	c := NewCollector(&fakeSource{responses: []ECUResponse{first, first, second}}, time.Minute)
+	updates := make(chan Update, 10)
+	unsubscribe := c.Subscribe(updates)
+
+	_, err := c.Poll()
+	require.NoError(t, err)
+	require.NotNil(t, (<-updates).Snapshot)
+
+	// An unchanged ECU timestamp produces no update
+	_, err = c.Poll()
+	require.NoError(t, err)
+	require.Len(t, updates, 0)
+
+	_, err = c.Poll()
+	require.NoError(t, err)
+	require.NotNil(t, (<-updates).Snapshot)
+	require.Equal(t, EventInverterOffline, (<-updates).Event.Type)
+
+	unsubscribe()
+	_, err = c.Poll()
+	require.NoError(t, err)
+	require.Len(t, updates, 0)
+}
+
+// streamCollector returns a collector that has polled once, and a function
+// to poll a snapshot with a new timestamp and an offline inverter
+func streamCollector(t *testing.T) (*Collector, func()) {
+	first := testSnapshot(time.Now()).ECUResponse
+	second := testSnapshot(time.Now()).ECUResponse
+	second.ArrayInfo.Timestamp = first.ArrayInfo.Timestamp.Add(5 * time.Minute)
+	second.ArrayInfo.Inverters[1].Online = false
+
+	c := NewCollector(&fakeSource{responses: []ECUResponse{first, second}}, time.Minute)
+	_, err := c.Poll()
+	require.NoError(t, err)
+	return c, func() {
+		_, err := c.Poll()
+		require.NoError(t, err)
+	}
+}
+
+func TestStreamSSE(t *testing.T) {
+	c, poll := streamCollector(t)
+	srv := httptest.NewServer(APIHandler(c))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/stream?ecu=216000011111")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	r := bufio.NewReader(resp.Body)
+
+	next := func() (string, string) {
+		var event, data string
+		for {
+			line, err := r.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			case line == "" && event != "":
+				return event, data
+			}
+		}
+	}
+
+	// The current snapshot is sent on connect
+	event, data := next()
+	require.Equal(t, "snapshot", event)
+	var doc JSONDocument
+	require.NoError(t, json.Unmarshal([]byte(data), &doc))
+	require.Equal(t, "216000011111", doc.ECU.EcuID)
+
+	poll()
+	event, _ = next()
+	require.Equal(t, "snapshot", event)
+	event, data = next()
+	require.Equal(t, "event", event)
+	var e JSONEvent
+	require.NoError(t, json.Unmarshal([]byte(data), &e))
+	require.Equal(t, EventInverterOffline, e.Type)
+	require.Equal(t, "801000030001", e.InverterID)
+}
+
+func TestStreamUnknownECU(t *testing.T) {
+	c, _ := streamCollector(t)
+	srv := httptest.NewServer(APIHandler(c))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/stream?ecu=1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	c, poll := streamCollector(t)
+	srv := httptest.NewServer(APIHandler(c))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, "GET /api/v1/stream HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	// Example from RFC 6455
+	require.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	next := func() StreamMessage {
+		opcode, payload, err := readWSFrame(r)
+		require.NoError(t, err)
+		require.Equal(t, wsText, opcode)
+		var msg StreamMessage
+		require.NoError(t, json.Unmarshal(payload, &msg))
+		return msg
+	}
+	require.Equal(t, "snapshot", next().Type)
+	poll()
+	require.Equal(t, "snapshot", next().Type)
+	require.Equal(t, "event", next().Type)
+
+	// A masked close frame is answered with a close frame
+	conn.Write([]byte{0x80 | wsClose, 0x80, 1, 2, 3, 4})
+	opcode, _, err := readWSFrame(r)
+	require.NoError(t, err)
+	require.Equal(t, wsClose, opcode)
+}
@@ -0,0 +1,55 @@
+package ecur
+
+import (
+	"text/template"
+	"time"
+)
+
+// TemplateInverter is the per inverter view used by the 'inverters' template
+// function. It adds the signal strength to the inverter information
+type TemplateInverter struct {
+	InverterInfo
+	Signal        int     // raw zigbee signal strength (0-255)
+	SignalPercent float64 // signal strength in %
+}
+
+// TemplateFuncs returns helper functions for text/templates that render an
+// ECUResponse:
+//
+//	kw        converts W to kW
+//	kwh       converts Wh to kWh
+//	inverters returns the inverters of the response, including signal strength
+//	apstime   formats a timestamp, with an optional Go layout
+//	ago       returns the time elapsed since a timestamp, rounded to seconds
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"kw":  func(w int) float64 { return float64(w) / 1000 },
+		"kwh": func(wh int) float64 { return float64(wh) / 1000 },
+		"inverters": func(r ECUResponse) []TemplateInverter {
+			var res []TemplateInverter
+			for _, inv := range r.ArrayInfo.Inverters {
+				signal, _ := r.Signal(inv.ID)
+				res = append(res, TemplateInverter{
+					InverterInfo:  inv,
+					Signal:        signal,
+					SignalPercent: SignalPercent(signal),
+				})
+			}
+			return res
+		},
+		"apstime": func(t time.Time, layout ...string) string {
+			if len(layout) > 0 {
+				return t.Format(layout[0])
+			}
+			return t.Format("2006-01-02 15:04:05")
+		},
+		"ago": func(t time.Time) time.Duration {
+			return time.Since(t).Round(time.Second)
+		},
+	}
+}
+
+// NewTemplate parses a text/template with the TemplateFuncs helpers available
+func NewTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(TemplateFuncs()).Parse(text)
+}
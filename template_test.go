@@ -0,0 +1,31 @@
+package ecur
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate(t *testing.T) {
+	s := testSnapshot(time.Now())
+	s.ECUInfo.LastPower = 1250
+	s.ArrayInfo.Inverters[0].PowerA = 57
+	s.InverterSignalInfo.Inverters = []InverterSignal{{ID: "801000030000", Signal: 128}}
+
+	tmpl, err := NewTemplate("test", `{{ kw .ECUInfo.LastPower }} kW, {{ printf "%.2f" (kwh .ECUInfo.TodayEnergy) }} kWh @ {{ apstime .ArrayInfo.Timestamp "15:04" }}
+{{ range inverters . }}{{ .ID }}: {{ .TotalPower }} W ({{ .SignalPercent }}%)
+{{ end }}`)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, tmpl.Execute(&buf, s.ECUResponse))
+	require.Equal(t, `1.25 kW, 3.96 kWh @ 10:00
+801000030000: 57 W (50%)
+801000030001: 0 W (0%)
+`, buf.String())
+
+	_, err = NewTemplate("invalid", "{{ .ECUInfo.LastPower ")
+	require.Error(t, err)
+}